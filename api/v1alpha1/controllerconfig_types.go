@@ -0,0 +1,207 @@
+/*
+Copyright 2021 apstndb.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+//+kubebuilder:object:root=true
+
+// ControllerConfig is the Schema for the configuration file of the controller.
+// Fields marked as reloadable take effect without restart when the file is modified.
+type ControllerConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ControllerManagerConfigurationSpec returns the configurations for controllers
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	// DefaultRegistries replace the public hostnames of Container Registry and Artifact Registry if not empty.
+	// Reloadable.
+	// +optional
+	DefaultRegistries []string `json:"defaultRegistries,omitempty"`
+	// ExtraRegistries are hostnames written to all Secrets in addition to DefaultRegistries.
+	// Reloadable.
+	// +optional
+	ExtraRegistries []string `json:"extraRegistries,omitempty"`
+
+	// RefreshMargin is how long before the expiry the credential is refreshed. Defaults to 15m.
+	// Reloadable.
+	// +optional
+	RefreshMargin *metav1.Duration `json:"refreshMargin,omitempty"`
+	// DefaultScopes are used if spec.scopes of ImagePullSecret is empty.
+	// Defaults to devstorage.read_only and cloud-platform.read-only scopes.
+	// Reloadable.
+	// +optional
+	DefaultScopes []string `json:"defaultScopes,omitempty"`
+
+	// Endpoints override the public endpoints of STS and IAM Credentials.
+	// Reloadable.
+	// +optional
+	Endpoints EndpointsSpec `json:"endpoints,omitempty"`
+
+	// RateLimit limits the token exchanges per GCP project to stay within the quota of STS and IAM Credentials.
+	// Reloadable.
+	// +optional
+	RateLimit RateLimitSpec `json:"rateLimit,omitempty"`
+
+	// HealthChecks configures the health and readiness checks of the credentials.
+	// It is not named health, which is the probe address of the inlined ControllerManagerConfigurationSpec.
+	// Reloadable.
+	// +optional
+	HealthChecks HealthChecksSpec `json:"healthChecks,omitempty"`
+
+	// MaxConcurrentReconciles is the number of ImagePullSecrets reconciled concurrently. Defaults to 1.
+	// +optional
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+	// WatchNamespaces restricts the namespaces watched by the controller. Defaults to all namespaces.
+	// +optional
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+
+	// ShardCount splits the namespaces into shards which are distributed among the replicas by Leases.
+	// Zero or one disables sharding. Sharding requires leader election to be disabled.
+	// +optional
+	ShardCount int `json:"shardCount,omitempty"`
+	// StartupRefreshJitter bounds the random delay of the refreshes which are due when a replica starts
+	// or acquires a shard, so that they don't burst at once. Defaults to 5m, and 0s disables the jitter.
+	// Reloadable.
+	// +optional
+	StartupRefreshJitter *metav1.Duration `json:"startupRefreshJitter,omitempty"`
+
+	// Features toggles optional features.
+	// Reloadable.
+	// +optional
+	Features ControllerFeatures `json:"features,omitempty"`
+}
+
+// RateLimitSpec is a token bucket per GCP project.
+// STS is charged to the project of the workload identity pool, and GenerateAccessToken to the project of the GSA.
+type RateLimitSpec struct {
+	// PerProjectRequestsPerMinute is the sustained rate of token exchanges per project. Defaults to 600.
+	// Negative disables the limit.
+	// +optional
+	PerProjectRequestsPerMinute int `json:"perProjectRequestsPerMinute,omitempty"`
+	// PerProjectBurst is the number of token exchanges per project allowed at once. Defaults to 60.
+	// +optional
+	PerProjectBurst int `json:"perProjectBurst,omitempty"`
+}
+
+// HealthChecksSpec configures /healthz and /readyz in addition to the probe address in the manager options.
+type HealthChecksSpec struct {
+	// SkipConnectivityCheck makes the controller ready without reaching STS and IAM Credentials,
+	// e.g. in air-gapped test setups.
+	// +optional
+	SkipConnectivityCheck bool `json:"skipConnectivityCheck,omitempty"`
+	// ExpiredCredentialsThresholdPercent is the percentage of ImagePullSecrets with expired credentials
+	// above which /healthz reports the controller degraded. Defaults to 50, and 0 reports any expired credential.
+	// +optional
+	ExpiredCredentialsThresholdPercent *int `json:"expiredCredentialsThresholdPercent,omitempty"`
+}
+
+// ControllerFeatures toggles optional features of the controller.
+type ControllerFeatures struct {
+	// InjectImagePullSecretsByDefault enables the injection in namespaces without the inject label.
+	// +optional
+	InjectImagePullSecretsByDefault bool `json:"injectImagePullSecretsByDefault,omitempty"`
+	// AllowLocalSubjectTokenSources allows subject token sources which run in the controller, i.e. file and executable.
+	// +optional
+	AllowLocalSubjectTokenSources bool `json:"allowLocalSubjectTokenSources,omitempty"`
+	// SkipRequesterAuthorization disables the check that the requester of an ImagePullSecret may create
+	// serviceaccounts/token for its serviceAccountName. The requester is recorded by the webhook,
+	// so it is required if the webhook is disabled. spec.subjectToken.oidc is refused while it is skipped.
+	// +optional
+	SkipRequesterAuthorization bool `json:"skipRequesterAuthorization,omitempty"`
+}
+
+// Validate reports all invalid fields.
+func (c *ControllerConfig) Validate() error {
+	var errs []string
+	for i, r := range append(append([]string{}, c.DefaultRegistries...), c.ExtraRegistries...) {
+		if msgs := validation.IsDNS1123Subdomain(r); len(msgs) != 0 {
+			errs = append(errs, fmt.Sprintf("registries[%d]: %q: %s", i, r, strings.Join(msgs, ", ")))
+		}
+	}
+	if c.RefreshMargin != nil && c.RefreshMargin.Duration <= 0 {
+		errs = append(errs, fmt.Sprintf("refreshMargin: must be positive: %v", c.RefreshMargin.Duration))
+	}
+	for i, s := range c.DefaultScopes {
+		if u, err := url.Parse(s); err != nil || u.Scheme != "https" {
+			errs = append(errs, fmt.Sprintf("defaultScopes[%d]: must be a https URL: %q", i, s))
+		}
+	}
+	if s := c.Endpoints.STS; s != "" {
+		if err := ValidateStsEndpoint(s); err != nil {
+			errs = append(errs, fmt.Sprintf("endpoints.sts: %v", err))
+		}
+	}
+	if s := c.Endpoints.IAMCredentials; s != "" {
+		if err := ValidateIamCredentialsEndpoint(s); err != nil {
+			errs = append(errs, fmt.Sprintf("endpoints.iamCredentials: %v", err))
+		}
+	}
+	if c.RateLimit.PerProjectBurst < 0 {
+		errs = append(errs, fmt.Sprintf("rateLimit.perProjectBurst: must not be negative: %d", c.RateLimit.PerProjectBurst))
+	}
+	if p := c.HealthChecks.ExpiredCredentialsThresholdPercent; p != nil && (*p < 0 || *p > 100) {
+		errs = append(errs, fmt.Sprintf("healthChecks.expiredCredentialsThresholdPercent: must be between 0 and 100: %d", *p))
+	}
+	if c.MaxConcurrentReconciles < 0 {
+		errs = append(errs, fmt.Sprintf("maxConcurrentReconciles: must not be negative: %d", c.MaxConcurrentReconciles))
+	}
+	if c.ShardCount < 0 {
+		errs = append(errs, fmt.Sprintf("shardCount: must not be negative: %d", c.ShardCount))
+	}
+	if c.StartupRefreshJitter != nil && c.StartupRefreshJitter.Duration < 0 {
+		errs = append(errs, fmt.Sprintf("startupRefreshJitter: must not be negative: %v", c.StartupRefreshJitter.Duration))
+	}
+	for i, ns := range c.WatchNamespaces {
+		if msgs := validation.IsDNS1123Label(ns); len(msgs) != 0 {
+			errs = append(errs, fmt.Sprintf("watchNamespaces[%d]: %q: %s", i, ns, strings.Join(msgs, ", ")))
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid ControllerConfig: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func init() {
+	SchemeBuilder.Register(&ControllerConfig{})
+}
+
+// ValidateStsEndpoint checks that the STS endpoint is a https URL, so that the subject token is never sent in cleartext.
+func ValidateStsEndpoint(s string) error {
+	if u, err := url.Parse(s); err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("must be a https URL: %q", s)
+	}
+	return nil
+}
+
+// ValidateIamCredentialsEndpoint checks that the IAM Credentials endpoint is host:port of the gRPC endpoint.
+func ValidateIamCredentialsEndpoint(s string) error {
+	if host, port, err := net.SplitHostPort(s); err != nil || host == "" || port == "" || strings.Contains(s, "/") {
+		return fmt.Errorf("must be host:port: %q", s)
+	}
+	return nil
+}
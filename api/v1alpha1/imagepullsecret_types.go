@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -30,12 +31,259 @@ type ImagePullSecretSpec struct {
 
 	SecretName string `json:"secretName"`
 
-	ServiceAccountName string `json:"serviceAccountName"`
+	// ServiceAccountName is the subject Kubernetes service account in the same namespace.
+	// Either ServiceAccountName or SubjectToken is required.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
 
 	// GsaEmail must be email of the GCP Service Account.
-	GsaEmail string `json:"gsaEmail"`
+	// It is required unless CredentialConfig is set.
+	// +optional
+	GsaEmail string `json:"gsaEmail,omitempty"`
 	// WorkloadIdentityPoolPrivider must be `projects/${PROJECT_NUMBER}/locations/global/workloadIdentityPools/${POOL}/providers/${PROVIDER}`
-	WorkloadIdentityPoolProvider string `json:"workloadIdentityPoolProvider"`
+	// It is required unless CredentialConfig is set.
+	// +optional
+	WorkloadIdentityPoolProvider string `json:"workloadIdentityPoolProvider,omitempty"`
+
+	// CredentialConfig refers an external_account credential configuration in a ConfigMap in the same namespace,
+	// which is generated by `gcloud iam workload-identity-pools create-cred-config`.
+	// It replaces GsaEmail and WorkloadIdentityPoolProvider.
+	// Its credential_source is used only if neither ServiceAccountName nor SubjectToken is set.
+	// +optional
+	CredentialConfig *CredentialConfigSource `json:"credentialConfig,omitempty"`
+
+	// Scopes of the access token.
+	// Defaults to read-only scopes which are enough to pull images from Container Registry and Artifact Registry.
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+	// TokenLifetime is the lifetime of the access token up to 12h. Defaults to 1h.
+	// Lifetime longer than 1h requires constraints/iam.allowServiceAccountCredentialLifetimeExtension.
+	// +optional
+	TokenLifetime *metav1.Duration `json:"tokenLifetime,omitempty"`
+	// Delegates are ordered emails of the intermediate GCP Service Accounts to reach GsaEmail.
+	// The federated principal impersonates the first delegate, and each delegate impersonates the next one.
+	// +optional
+	// +kubebuilder:validation:MaxItems=10
+	Delegates []string `json:"delegates,omitempty"`
+
+	// ServiceAccountToken configures the Kubernetes service account token exchanged with STS.
+	// +optional
+	ServiceAccountToken *ServiceAccountTokenSpec `json:"serviceAccountToken,omitempty"`
+
+	// SubjectToken configures the token exchanged with STS instead of the token of ServiceAccountName.
+	// +optional
+	SubjectToken *SubjectTokenSpec `json:"subjectToken,omitempty"`
+
+	// Endpoints override the endpoints of Google APIs, e.g. Private Service Connect endpoints.
+	// +optional
+	Endpoints *EndpointsSpec `json:"endpoints,omitempty"`
+	// ExtraRegistries are hostnames written to the Secret in addition to the public hostnames of
+	// Container Registry and Artifact Registry, e.g. private aliases of *-docker.pkg.dev.
+	// +optional
+	ExtraRegistries []string `json:"extraRegistries,omitempty"`
+	// RotationSchedule is a cron expression of the periodic rotation independent of the expiry, e.g. "0 3 * * *".
+	// It is in UTC unless prefixed with CRON_TZ=, e.g. "CRON_TZ=Asia/Tokyo 0 3 * * *".
+	// +optional
+	RotationSchedule string `json:"rotationSchedule,omitempty"`
+	// Verify pulls the manifests of the images with the minted credential to check that it is granted to read them.
+	// +optional
+	Verify *VerifySpec `json:"verify,omitempty"`
+	// Handover keeps the previous credential valid for a grace period after a refresh,
+	// so that pulls racing with the Secret update don't fail.
+	// +optional
+	Handover *HandoverSpec `json:"handover,omitempty"`
+	// SecretTemplate customizes the generated Secrets. Changes are applied without minting a new credential.
+	// +optional
+	SecretTemplate *SecretTemplate `json:"secretTemplate,omitempty"`
+	// Outputs write the same credential in additional formats, e.g. for build Pods and node bootstrappers.
+	// Changes are applied without minting a new credential.
+	// +optional
+	Outputs []Output `json:"outputs,omitempty"`
+}
+
+// OutputFormat is the file format of an output.
+// +kubebuilder:validation:Enum=DockerConfigJson;PodmanAuthJson;HelmRegistryConfig;ContainerdHostsToml
+type OutputFormat string
+
+const (
+	// OutputDockerConfigJson is ~/.docker/config.json with username and password, the same as the Secret.
+	OutputDockerConfigJson OutputFormat = "DockerConfigJson"
+	// OutputPodmanAuthJson is auth.json of containers-auth.json(5) read by Podman, Buildah and Skopeo.
+	OutputPodmanAuthJson OutputFormat = "PodmanAuthJson"
+	// OutputHelmRegistryConfig is registry/config.json of Helm for OCI registries.
+	OutputHelmRegistryConfig OutputFormat = "HelmRegistryConfig"
+	// OutputContainerdHostsToml is a fragment of hosts.toml of containerd with the Authorization header of each registry.
+	OutputContainerdHostsToml OutputFormat = "ContainerdHostsToml"
+)
+
+// OutputKind is the kind of the target of an output.
+// +kubebuilder:validation:Enum=Secret;ConfigMap
+type OutputKind string
+
+const (
+	OutputSecret    OutputKind = "Secret"
+	OutputConfigMap OutputKind = "ConfigMap"
+)
+
+// OutputTarget is a Secret or a ConfigMap in the namespace of the ImagePullSecret.
+type OutputTarget struct {
+	// Kind defaults to Secret. A ConfigMap exposes the access token to whoever can read ConfigMaps,
+	// so use it only for consumers which can't read Secrets.
+	// +optional
+	Kind OutputKind `json:"kind,omitempty"`
+	// Name of the target. It is created and owned by the ImagePullSecret, and it must not be spec.secretName.
+	Name string `json:"name"`
+}
+
+// Output writes the credential in the format to the key of the target.
+type Output struct {
+	Format OutputFormat `json:"format"`
+	Target OutputTarget `json:"target"`
+	// Key in the data of the target. Defaults to the file name of the format,
+	// i.e. config.json, auth.json, config.json and hosts.toml.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// SecretTemplate is the metadata and the additional keys of the generated Secrets.
+type SecretTemplate struct {
+	// Metadata are the labels and annotations of the Secrets, e.g. for Argo CD, reflector or Kyverno.
+	// The label image-pull-secret.apstn.dev/owner is reserved.
+	// +optional
+	Metadata SecretTemplateMetadata `json:"metadata,omitempty"`
+	// TokenKey is the key of the plain access token, e.g. token, for consumers which don't read .dockerconfigjson.
+	// +optional
+	TokenKey string `json:"tokenKey,omitempty"`
+	// ExpiryKey is the key of the expiry of the access token in RFC3339, e.g. expiry.
+	// +optional
+	ExpiryKey string `json:"expiryKey,omitempty"`
+}
+
+// SecretTemplateMetadata is the subset of ObjectMeta applied to the generated Secrets.
+type SecretTemplateMetadata struct {
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// HandoverMode is how the previous credential is kept during the grace period.
+// +kubebuilder:validation:Enum=Alias;Versioned
+type HandoverMode string
+
+const (
+	// HandoverAlias keeps the previous access token in the same Secret under https:// aliases of the registries.
+	// kubelet tries all credentials matching the registry, so either of the tokens works.
+	HandoverAlias HandoverMode = "Alias"
+	// HandoverVersioned writes each credential to a new Secret named <secretName>-<hash>,
+	// switches the ServiceAccounts to it in a single update and deletes the previous Secret after the grace period.
+	// The Pod webhook doesn't inject the versioned Secrets because they are deleted while Pods refer to them.
+	HandoverVersioned HandoverMode = "Versioned"
+)
+
+// HandoverSpec configures the handover of the credential on refresh.
+type HandoverSpec struct {
+	Mode HandoverMode `json:"mode"`
+	// GracePeriod is how long the previous credential is kept after the new one is written. Defaults to 10m.
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+	// ServiceAccounts are names of the ServiceAccounts in the namespace whose imagePullSecrets are switched to the new Secret.
+	// It is only valid in Versioned mode.
+	// +optional
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+}
+
+// VerifySpec lists the images to verify the registry access.
+type VerifySpec struct {
+	// Images are references of the images, e.g. us-docker.pkg.dev/project/repo/image:tag.
+	// Their registries must be in the Secret.
+	// +kubebuilder:validation:MinItems=1
+	Images []string `json:"images"`
+}
+
+// EndpointsSpec overrides the endpoints of the controller.
+// They receive the subject token, so ImagePullSecretPolicies may restrict them.
+type EndpointsSpec struct {
+	// STS is the base URL of Security Token Service, e.g. https://sts-xyz.p.googleapis.com/
+	// +optional
+	// +kubebuilder:validation:Pattern=`^https://[^/]+(/.*)?$`
+	STS string `json:"sts,omitempty"`
+	// IAMCredentials is the gRPC endpoint of IAM Service Account Credentials API, e.g. iamcredentials-xyz.p.googleapis.com:443
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[^/:]+:[0-9]+$`
+	IAMCredentials string `json:"iamCredentials,omitempty"`
+}
+
+// ServiceAccountTokenSpec configures the token requested for ServiceAccountName.
+type ServiceAccountTokenSpec struct {
+	// Audience of the token. Defaults to the full resource name of WorkloadIdentityPoolProvider,
+	// which is the default allowed audience of the provider.
+	// Set this if the provider is configured with allowed audiences.
+	// +optional
+	Audience string `json:"audience,omitempty"`
+	// ExpirationSeconds is the requested lifetime of the token. Defaults to the API server default.
+	// The token is used only once to exchange with STS, so it can be short.
+	// +optional
+	// +kubebuilder:validation:Minimum=600
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+	// BindToSecret binds the token to the Secret of SecretName so that the token is invalidated when the Secret is deleted.
+	// The first token is not bound because the Secret doesn't exist yet.
+	// +optional
+	BindToSecret bool `json:"bindToSecret,omitempty"`
+}
+
+// CredentialConfigSource refers the credential configuration file in a ConfigMap.
+type CredentialConfigSource struct {
+	ConfigMapRef corev1.LocalObjectReference `json:"configMapRef"`
+	// Key of the ConfigMap. Defaults to "credential-configuration.json".
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// SubjectTokenSpec configures the source of the subject token which is not a Kubernetes service account.
+// Exactly one of the fields must be set.
+// File and Executable run in the controller, so they are allowed only if the controller runs with --allow-local-subject-token-sources.
+type SubjectTokenSpec struct {
+	// File reads the token from the file on each refresh, e.g. a projected volume of the controller.
+	// +optional
+	File *FileSubjectTokenSource `json:"file,omitempty"`
+	// OIDC issues the token from an external OpenID Provider by client credentials grant.
+	// +optional
+	OIDC *OIDCSubjectTokenSource `json:"oidc,omitempty"`
+	// Executable runs the command which follows the executable-sourced credential format of Google auth libraries.
+	// +optional
+	Executable *ExecutableSubjectTokenSource `json:"executable,omitempty"`
+}
+
+type FileSubjectTokenSource struct {
+	Path string `json:"path"`
+}
+
+type OIDCSubjectTokenSource struct {
+	// Issuer must serve /.well-known/openid-configuration.
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"clientID"`
+	// ClientSecretRef refers the client secret in a Secret in the same namespace.
+	// The requester must be allowed to get the Secret, so OIDC requires the requester authorization.
+	ClientSecretRef corev1.SecretKeySelector `json:"clientSecretRef"`
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+	// Audience is sent as audience parameter of the token request if not empty.
+	// +optional
+	Audience string `json:"audience,omitempty"`
+}
+
+type ExecutableSubjectTokenSource struct {
+	// Command is split by whitespace and executed without shell.
+	Command string `json:"command"`
+	// TimeoutMillis defaults to 30 seconds.
+	// +optional
+	// +kubebuilder:validation:Minimum=5000
+	// +kubebuilder:validation:Maximum=120000
+	TimeoutMillis *int32 `json:"timeoutMillis,omitempty"`
+	// OutputFile caches the response of the executable.
+	// +optional
+	OutputFile string `json:"outputFile,omitempty"`
 }
 
 // ImagePullSecretStatus defines the observed state of ImagePullSecret
@@ -43,8 +291,65 @@ type ImagePullSecretStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	ExpiresAt metav1.Time `json:"expiresAt,omitempty"`
+
+	// LastRefreshTime is when the credential was minted last.
+	// +optional
+	LastRefreshTime *metav1.Time `json:"lastRefreshTime,omitempty"`
+	// HandledForceRefresh is the value of the force-refresh annotation handled by the last refresh.
+	// +optional
+	HandledForceRefresh string `json:"handledForceRefresh,omitempty"`
+	// HandledRotateAt is the value of the rotate-at annotation handled by the last refresh.
+	// +optional
+	HandledRotateAt string `json:"handledRotateAt,omitempty"`
+
+	// CurrentSecretName is the Secret holding the current credential.
+	// It is spec.secretName unless spec.handover.mode is Versioned.
+	// +optional
+	CurrentSecretName string `json:"currentSecretName,omitempty"`
+	// PreviousSecretName is the versioned Secret holding the previous credential until HandoverDeadline.
+	// +optional
+	PreviousSecretName string `json:"previousSecretName,omitempty"`
+	// HandoverDeadline is when the previous credential is removed.
+	// +optional
+	HandoverDeadline *metav1.Time `json:"handoverDeadline,omitempty"`
+	// OutputTargets are the targets written by the controller. Targets removed from spec.outputs are deleted.
+	// +optional
+	OutputTargets []OutputTarget `json:"outputTargets,omitempty"`
+	// MintedSpecHash is the hash of the spec which the current credential is minted for,
+	// excluding spec.secretTemplate and spec.outputs.
+	// A spec change which keeps it is applied without minting.
+	// +optional
+	MintedSpecHash string `json:"mintedSpecHash,omitempty"`
+	// SecretHash is the hash of the content of the current Secret written by the controller.
+	// After a restart, the Secret is reused without minting if it still matches.
+	// +optional
+	SecretHash string `json:"secretHash,omitempty"`
+	// DelegationChain is the chain of GCP Service Accounts impersonated by the last successful refresh.
+	// +optional
+	DelegationChain []string `json:"delegationChain,omitempty"`
+
+	// Conditions represent the latest available observations of the ImagePullSecret's state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// ConditionReady indicates whether the last reconciliation minted the credential successfully.
+	ConditionReady = "Ready"
+	// ConditionDegraded indicates that refreshing failed and the Secret still holds the last good credential.
+	ConditionDegraded = "Degraded"
+	// ConditionPolicyCompliant indicates whether the ImagePullSecret is allowed by ImagePullSecretPolicies.
+	// It is Unknown if the controller watches only some namespaces and doesn't enforce them.
+	ConditionPolicyCompliant = "PolicyCompliant"
+	// ConditionRequesterAuthorized indicates whether the requester may create serviceaccounts/token for ServiceAccountName
+	// and get the Secret of SubjectToken.OIDC.ClientSecretRef.
+	ConditionRequesterAuthorized = "RequesterAuthorized"
+	// ConditionRegistryAccessVerified indicates whether the manifests of spec.verify.images are readable with the minted credential.
+	ConditionRegistryAccessVerified = "RegistryAccessVerified"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="SECRET",type=string,JSONPath=`.spec.secretName`
@@ -52,6 +357,8 @@ type ImagePullSecretStatus struct {
 //+kubebuilder:printcolumn:name="GSA_EMAIL",type=string,JSONPath=`.spec.gsaEmail`
 //+kubebuilder:printcolumn:name="PROVIDER",type=string,JSONPath=`.spec.workloadIdentityPoolProvider`
 //+kubebuilder:printcolumn:name="CURRENT_EXPIRES_AT",type=string,JSONPath=`.status.expiresAt`
+//+kubebuilder:printcolumn:name="READY",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="REASON",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`,priority=1
 
 // ImagePullSecret is the Schema for the imagepullsecrets API
 type ImagePullSecret struct {
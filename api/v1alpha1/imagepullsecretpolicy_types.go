@@ -0,0 +1,86 @@
+/*
+Copyright 2021 apstndb.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ImagePullSecretPolicySpec defines what ImagePullSecrets in the selected namespaces may federate.
+// Patterns are matched by path.Match, e.g. *@example.iam.gserviceaccount.com.
+// An empty list doesn't restrict the field, except that endpoint overrides are allowed only if listed.
+type ImagePullSecretPolicySpec struct {
+	// NamespaceSelector selects the namespaces to which the policy applies. Empty selector selects all namespaces.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// AllowedServiceAccountNames are patterns of Kubernetes Service Accounts whose tokens may be requested.
+	// +optional
+	AllowedServiceAccountNames []string `json:"allowedServiceAccountNames,omitempty"`
+	// AllowedGsaEmails are patterns of GCP Service Accounts which may be impersonated, including delegates.
+	// +optional
+	AllowedGsaEmails []string `json:"allowedGsaEmails,omitempty"`
+	// AllowedWorkloadIdentityPoolProviders are patterns of full resource names of the providers,
+	// e.g. projects/123456789012/locations/global/workloadIdentityPools/pool/providers/*
+	// +optional
+	AllowedWorkloadIdentityPoolProviders []string `json:"allowedWorkloadIdentityPoolProviders,omitempty"`
+	// AllowedRegistries are patterns of hostnames in spec.extraRegistries.
+	// +optional
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	// AllowedOidcIssuers are patterns of spec.subjectToken.oidc.issuer, e.g. https://login.example.com/*
+	// +optional
+	AllowedOidcIssuers []string `json:"allowedOidcIssuers,omitempty"`
+	// AllowedServiceAccountTokenAudiences are patterns of spec.serviceAccountToken.audience.
+	// +optional
+	AllowedServiceAccountTokenAudiences []string `json:"allowedServiceAccountTokenAudiences,omitempty"`
+	// AllowedStsEndpoints are patterns of STS endpoints which override the controller default,
+	// in spec.endpoints.sts or token_url of the credential configuration, e.g. https://sts-*.p.googleapis.com/
+	// Overrides are denied if empty, because the endpoint receives the subject token.
+	// +optional
+	AllowedStsEndpoints []string `json:"allowedStsEndpoints,omitempty"`
+	// AllowedIamCredentialsEndpoints are patterns of IAM Credentials endpoints which override the controller default,
+	// in spec.endpoints.iamCredentials or service_account_impersonation_url of the credential configuration,
+	// e.g. iamcredentials-*.p.googleapis.com:443
+	// Overrides are denied if empty, because the endpoint receives the federated access token.
+	// +optional
+	AllowedIamCredentialsEndpoints []string `json:"allowedIamCredentialsEndpoints,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// ImagePullSecretPolicy restricts ImagePullSecrets in the selected namespaces.
+// If any policy selects a namespace, ImagePullSecrets in it must be allowed by at least one of the selecting policies.
+type ImagePullSecretPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ImagePullSecretPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ImagePullSecretPolicyList contains a list of ImagePullSecretPolicy
+type ImagePullSecretPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ImagePullSecretPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ImagePullSecretPolicy{}, &ImagePullSecretPolicyList{})
+}
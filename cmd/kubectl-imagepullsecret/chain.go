@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
+)
+
+// defaultCredentialConfigKey is the same as the controller.
+const defaultCredentialConfigKey = "credential-configuration.json"
+
+// chain is the federation chain of an ImagePullSecret resolved in the same way as the controller,
+// except the controller-wide defaults which the plugin can't know.
+type chain struct {
+	// subject describes the source of the subject token.
+	subject                string
+	audience               string
+	subjectTokenType       string
+	stsEndpoint            string
+	delegates              []string
+	gsaEmail               string
+	iamCredentialsEndpoint string
+
+	externalAccount *tokensource.ExternalAccountConfig
+}
+
+// provider returns the full resource name of the workload identity pool provider.
+func (c *chain) provider() string {
+	return strings.TrimPrefix(c.audience, "//iam.googleapis.com/")
+}
+
+func (cli *cli) resolveChain(ctx context.Context, res *examplev1alpha1.ImagePullSecret) (*chain, error) {
+	c := &chain{
+		audience:  fmt.Sprintf("//iam.googleapis.com/%s", res.Spec.WorkloadIdentityPoolProvider),
+		gsaEmail:  res.Spec.GsaEmail,
+		delegates: res.Spec.Delegates,
+	}
+
+	if ref := res.Spec.CredentialConfig; ref != nil {
+		key := ref.Key
+		if key == "" {
+			key = defaultCredentialConfigKey
+		}
+		cm, err := cli.clientset.CoreV1().ConfigMaps(res.Namespace).Get(ctx, ref.ConfigMapRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("credential configuration: %w", err)
+		}
+		ea, err := tokensource.ParseExternalAccountConfig([]byte(cm.Data[key]))
+		if err != nil {
+			return nil, err
+		}
+		if c.gsaEmail, err = ea.ServiceAccountEmail(); err != nil {
+			return nil, err
+		}
+		if c.stsEndpoint, err = ea.StsEndpoint(); err != nil {
+			return nil, err
+		}
+		if c.iamCredentialsEndpoint, err = ea.IamCredentialsEndpoint(); err != nil {
+			return nil, err
+		}
+		c.audience, c.subjectTokenType, c.externalAccount = ea.Audience, ea.SubjectTokenType, ea
+	}
+	if e := res.Spec.Endpoints; e != nil {
+		if e.STS != "" {
+			c.stsEndpoint = e.STS
+		}
+		if e.IAMCredentials != "" {
+			c.iamCredentialsEndpoint = e.IAMCredentials
+		}
+	}
+
+	switch st := res.Spec.SubjectToken; {
+	case res.Spec.ServiceAccountName != "":
+		c.subject = fmt.Sprintf("Kubernetes Service Account %s/%s", res.Namespace, res.Spec.ServiceAccountName)
+	case st != nil && st.OIDC != nil:
+		c.subject = fmt.Sprintf("OIDC client credentials of %s at %s", st.OIDC.ClientID, st.OIDC.Issuer)
+	case st != nil && st.File != nil:
+		c.subject = fmt.Sprintf("file %s in the controller", st.File.Path)
+	case st != nil && st.Executable != nil:
+		c.subject = fmt.Sprintf("executable %q in the controller", st.Executable.Command)
+	case c.externalAccount != nil:
+		c.subject = fmt.Sprintf("credential_source of ConfigMap %s", res.Spec.CredentialConfig.ConfigMapRef.Name)
+	default:
+		c.subject = "unknown"
+	}
+	return c, nil
+}
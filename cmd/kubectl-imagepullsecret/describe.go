@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+// maxEvents is the number of recent events shown by describe.
+const maxEvents = 10
+
+type dockerConfigJSON struct {
+	Auths map[string]struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	} `json:"auths"`
+}
+
+func (cli *cli) describe(ctx context.Context, res *examplev1alpha1.ImagePullSecret) error {
+	c, err := cli.resolveChain(ctx, res)
+	if err != nil {
+		return err
+	}
+	secretName := res.Spec.SecretName
+	if res.Status.CurrentSecretName != "" {
+		secretName = res.Status.CurrentSecretName
+	}
+	secret, err := cli.clientset.CoreV1().Secrets(res.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		// The Secret may not exist yet if the first exchange failed, so describe the rest.
+		fmt.Fprintf(cli.out, "warning: Secret %s: %v\n\n", secretName, err)
+		secret = nil
+	}
+	events, err := cli.clientset.CoreV1().Events(res.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.name": res.Name, "involvedObject.uid": string(res.UID)}.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(cli.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", res.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", res.Namespace)
+
+	fmt.Fprintf(w, "Chain:\n")
+	fmt.Fprintf(w, "  Subject:\t%s\n", c.subject)
+	fmt.Fprintf(w, "  Provider:\t%s\n", c.provider())
+	for i, d := range c.delegates {
+		fmt.Fprintf(w, "  Delegate %d:\t%s\n", i+1, d)
+	}
+	fmt.Fprintf(w, "  GSA:\t%s\n", c.gsaEmail)
+	if len(res.Status.DelegationChain) > 0 {
+		fmt.Fprintf(w, "  Last Minted By:\t%s\n", strings.Join(res.Status.DelegationChain, " -> "))
+	}
+
+	fmt.Fprintf(w, "Secret:\t%s\n", secretName)
+	if t := res.Status.HandoverDeadline; t != nil {
+		fmt.Fprintf(w, "Handover Until:\t%s\n", t.Format(time.RFC3339))
+	}
+	if secret != nil {
+		if err := describeSecret(w, secret); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "Expires At:\t%s\n", describeExpiry(res.Status.ExpiresAt, time.Now()))
+	if t := res.Status.LastRefreshTime; t != nil {
+		fmt.Fprintf(w, "Last Refresh:\t%s (%s ago)\n", t.Format(time.RFC3339), time.Since(t.Time).Round(time.Second))
+	}
+
+	fmt.Fprintf(w, "Conditions:\n")
+	fmt.Fprintf(w, "  Type\tStatus\tReason\tMessage\n")
+	for _, cond := range res.Status.Conditions {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", cond.Type, cond.Status, cond.Reason, cond.Message)
+	}
+
+	fmt.Fprintf(w, "Events:\n")
+	items := events.Items
+	sort.Slice(items, func(i, j int) bool { return eventTime(&items[i]).Before(eventTime(&items[j])) })
+	if len(items) > maxEvents {
+		items = items[len(items)-maxEvents:]
+	}
+	fmt.Fprintf(w, "  Type\tReason\tAge\tMessage\n")
+	for i := range items {
+		e := &items[i]
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", e.Type, e.Reason, time.Since(eventTime(e)).Round(time.Second), e.Message)
+	}
+	return w.Flush()
+}
+
+// describeSecret prints the registries of the Secret with the access tokens masked.
+func describeSecret(w *tabwriter.Writer, secret *corev1.Secret) error {
+	var cfg dockerConfigJSON
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &cfg); err != nil {
+		return fmt.Errorf("Secret %s: %w", secret.Name, err)
+	}
+	registries := make([]string, 0, len(cfg.Auths))
+	for reg := range cfg.Auths {
+		registries = append(registries, reg)
+	}
+	sort.Strings(registries)
+	fmt.Fprintf(w, "  Registry\tUsername\tPassword\tEmail\n")
+	for _, reg := range registries {
+		auth := cfg.Auths[reg]
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", reg, auth.Username, maskToken(auth.Password), auth.Email)
+	}
+	return nil
+}
+
+// maskToken keeps only the prefix of the token, which is enough to tell tokens apart.
+func maskToken(token string) string {
+	const visible = 8
+	if len(token) <= visible {
+		return strings.Repeat("*", len(token))
+	}
+	return fmt.Sprintf("%s...(%d bytes)", token[:visible], len(token))
+}
+
+func describeExpiry(expiresAt metav1.Time, now time.Time) string {
+	if expiresAt.IsZero() {
+		return "<never minted>"
+	}
+	d := expiresAt.Sub(now).Round(time.Second)
+	if d <= 0 {
+		return fmt.Sprintf("%s (expired %s ago)", expiresAt.Format(time.RFC3339), -d)
+	}
+	return fmt.Sprintf("%s (in %s)", expiresAt.Format(time.RFC3339), d)
+}
+
+func eventTime(e *corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2021 apstndb.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-imagepullsecret inspects and debugs ImagePullSecrets.
+// Put it in PATH to use it as `kubectl imagepullsecret`.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+const usage = `Usage: kubectl imagepullsecret <command> [flags] NAME
+
+Commands:
+  describe  Show the federation chain, the generated Secret with masked tokens, the expiry and recent events.
+  test      Perform the token exchange locally with your credentials and report which hop fails.
+
+Flags:
+`
+
+// cli holds the clients authenticated with the user's kubeconfig.
+type cli struct {
+	namespace string
+	client    client.Client
+	clientset *kubernetes.Clientset
+	out       io.Writer
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("kubectl-imagepullsecret", flag.ContinueOnError)
+	var kubeconfig, kubecontext, namespace string
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+	fs.StringVar(&kubecontext, "context", "", "The name of the kubeconfig context to use.")
+	fs.StringVar(&namespace, "namespace", "", "The namespace of the ImagePullSecret. Defaults to the namespace of the context.")
+	fs.StringVar(&namespace, "n", "", "Shorthand for --namespace.")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return fmt.Errorf("a command and NAME are required")
+	}
+	command, name := positional[0], positional[1]
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: kubecontext})
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	if namespace == "" {
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			return err
+		}
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(examplev1alpha1.AddToScheme(scheme))
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	cli := &cli{namespace: namespace, client: c, clientset: clientset, out: os.Stdout}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var res examplev1alpha1.ImagePullSecret
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &res); err != nil {
+		return err
+	}
+
+	switch command {
+	case "describe":
+		return cli.describe(ctx, &res)
+	case "test":
+		return cli.test(ctx, &res)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command: %s", command)
+	}
+}
+
+// parseInterleaved parses flags before and after positional arguments like kubectl.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	goauth2 "google.golang.org/api/oauth2/v1"
+	"google.golang.org/api/option"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
+)
+
+// defaultScopes are the same as the controller.
+var defaultScopes = []string{
+	"https://www.googleapis.com/auth/devstorage.read_only",
+	"https://www.googleapis.com/auth/cloud-platform.read-only",
+}
+
+// hop is a step of the token exchange.
+type hop struct {
+	name string
+	run  func(in *oauth2.Token) (*oauth2.Token, error)
+}
+
+// test performs the token exchange of the ImagePullSecret hop by hop with the user's credentials,
+// so the first failing hop is the one to fix.
+// It doesn't write the Secret.
+func (cli *cli) test(ctx context.Context, res *examplev1alpha1.ImagePullSecret) error {
+	c, err := cli.resolveChain(ctx, res)
+	if err != nil {
+		return err
+	}
+
+	subject, err := cli.subjectTokenSource(ctx, res, c)
+	if err != nil {
+		return err
+	}
+	scopes := res.Spec.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+	var lifetime time.Duration
+	if res.Spec.TokenLifetime != nil {
+		lifetime = res.Spec.TokenLifetime.Duration
+	}
+
+	hops := []hop{
+		{
+			name: fmt.Sprintf("subject token from %s", c.subject),
+			run: func(*oauth2.Token) (*oauth2.Token, error) {
+				return subject.Token()
+			},
+		},
+		{
+			name: fmt.Sprintf("STS exchange with %s", c.provider()),
+			run: func(in *oauth2.Token) (*oauth2.Token, error) {
+				ts, err := tokensource.OidcStsTokenSource(ctx, oauth2.StaticTokenSource(in), &tokensource.OidcStsTokenConfig{
+					Audience:         c.audience,
+					SubjectTokenType: c.subjectTokenType,
+					Endpoint:         c.stsEndpoint,
+				})
+				if err != nil {
+					return nil, err
+				}
+				return ts.Token()
+			},
+		},
+		{
+			name: fmt.Sprintf("impersonation of %s", strings.Join(append(append([]string(nil), c.delegates...), c.gsaEmail), " -> ")),
+			run: func(in *oauth2.Token) (*oauth2.Token, error) {
+				ts, err := tokensource.ImpersonateTokenSource(ctx, oauth2.StaticTokenSource(in), &tokensource.ImpersonateTokenConfig{
+					Target:    c.gsaEmail,
+					Scopes:    scopes,
+					Lifetime:  lifetime,
+					Delegates: c.delegates,
+					Endpoint:  c.iamCredentialsEndpoint,
+				})
+				if err != nil {
+					return nil, err
+				}
+				return ts.Token()
+			},
+		},
+		{
+			name: "tokeninfo of the access token",
+			run: func(in *oauth2.Token) (*oauth2.Token, error) {
+				svc, err := goauth2.NewService(ctx, option.WithTokenSource(oauth2.StaticTokenSource(in)))
+				if err != nil {
+					return nil, err
+				}
+				info, err := svc.Tokeninfo().AccessToken(in.AccessToken).Do()
+				if err != nil {
+					return nil, err
+				}
+				fmt.Fprintf(cli.out, "   email: %s\n   scope: %s\n", info.Email, info.Scope)
+				return in, nil
+			},
+		},
+	}
+
+	var tok *oauth2.Token
+	for i, h := range hops {
+		fmt.Fprintf(cli.out, "%d. %s\n", i+1, h.name)
+		tok, err = h.run(tok)
+		if err != nil {
+			class, _ := tokensource.ClassifyError(err)
+			fmt.Fprintf(cli.out, "   FAILED (%s): %v\n", class, err)
+			return fmt.Errorf("hop %d failed", i+1)
+		}
+		if tok.Expiry.IsZero() {
+			fmt.Fprintf(cli.out, "   OK\n")
+		} else {
+			fmt.Fprintf(cli.out, "   OK, expires in %s\n", time.Until(tok.Expiry).Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// subjectTokenSource returns the subject token source of the ImagePullSecret built with the user's credentials.
+// Sources read inside the controller, i.e. files, executables and credential_source, can't be reproduced locally.
+func (cli *cli) subjectTokenSource(ctx context.Context, res *examplev1alpha1.ImagePullSecret, c *chain) (oauth2.TokenSource, error) {
+	spec := res.Spec.SubjectToken
+	switch {
+	case res.Spec.ServiceAccountName != "" && spec == nil:
+		config := &tokensource.KubernetsTokenRequestTokenConfig{
+			ServiceAccountNamespace: res.Namespace,
+			ServiceAccountName:      res.Spec.ServiceAccountName,
+			Audiences:               []string{c.audience},
+		}
+		if sat := res.Spec.ServiceAccountToken; sat != nil {
+			if sat.Audience != "" {
+				config.Audiences = []string{sat.Audience}
+			}
+			config.ExpirationSeconds = sat.ExpirationSeconds
+		}
+		return tokensource.KubernetesTokenRequestTokenSource(ctx, cli.clientset, config)
+	case spec != nil && spec.OIDC != nil:
+		ref := spec.OIDC.ClientSecretRef
+		secret, err := cli.clientset.CoreV1().Secrets(res.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("client secret: %w", err)
+		}
+		return tokensource.OidcClientCredentialsTokenSource(ctx, &tokensource.OidcClientCredentialsTokenConfig{
+			Issuer:       spec.OIDC.Issuer,
+			ClientID:     spec.OIDC.ClientID,
+			ClientSecret: string(secret.Data[ref.Key]),
+			Scopes:       spec.OIDC.Scopes,
+			Audience:     spec.OIDC.Audience,
+		})
+	default:
+		return nil, fmt.Errorf("the subject token from %s can only be retrieved by the controller", c.subject)
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2021 apstndb.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+	"github.com/apstndb/image-pull-secret-controller/controllers"
+)
+
+// configReloadInterval is how often the configuration file is checked for modification.
+const configReloadInterval = 10 * time.Second
+
+var configLog = ctrl.Log.WithName("config")
+
+// controllerFlags are the flags which override the fields of ControllerConfig if they are set explicitly.
+type controllerFlags struct {
+	injectByDefault               bool
+	allowLocalSubjectTokenSources bool
+	stsEndpoint                   string
+	iamCredentialsEndpoint        string
+	extraRegistries               string
+	watchNamespaces               string
+	skipRequesterAuthorization    bool
+	maxConcurrentReconciles       int
+	shardCount                    int
+	startupRefreshJitter          time.Duration
+	skipConnectivityCheck         bool
+
+	set map[string]bool
+}
+
+func (f *controllerFlags) bind(fs *flag.FlagSet) {
+	fs.BoolVar(&f.injectByDefault, "inject-image-pull-secrets-by-default", false,
+		"Inject imagePullSecrets into Pods in namespaces without "+controllers.InjectLabel+" label. "+
+			"If false, namespaces must opt in with the label.")
+	fs.BoolVar(&f.allowLocalSubjectTokenSources, "allow-local-subject-token-sources", false,
+		"Allow ImagePullSecrets to read subject tokens from files or executables in the controller. "+
+			"Executables also require GOOGLE_EXTERNAL_ACCOUNT_ALLOW_EXECUTABLES=1.")
+	fs.StringVar(&f.stsEndpoint, "sts-endpoint", "",
+		"The base URL of Security Token Service, e.g. https://sts-xyz.p.googleapis.com/. Defaults to the public endpoint.")
+	fs.StringVar(&f.iamCredentialsEndpoint, "iamcredentials-endpoint", "",
+		"The gRPC endpoint of IAM Service Account Credentials API, e.g. iamcredentials-xyz.p.googleapis.com:443. Defaults to the public endpoint.")
+	fs.StringVar(&f.extraRegistries, "extra-registries", "",
+		"Comma separated registry hostnames written to Secrets in addition to the public hostnames of Container Registry and Artifact Registry.")
+	fs.StringVar(&f.watchNamespaces, "watch-namespaces", "",
+		"Comma separated namespaces watched by the controller. Defaults to all namespaces. "+
+			"ImagePullSecrets in other namespaces are refused, so the controller only needs namespaced Roles.")
+	fs.BoolVar(&f.skipRequesterAuthorization, "skip-requester-authorization", false,
+		"Skip the check that the requester of an ImagePullSecret may create serviceaccounts/token for its serviceAccountName. "+
+			"Required if the webhook is disabled because the webhook records the requester. spec.subjectToken.oidc is refused while it is skipped.")
+	fs.IntVar(&f.maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The number of ImagePullSecrets reconciled concurrently. The token exchanges are rate limited per GCP project regardless of it.")
+	fs.IntVar(&f.shardCount, "shard-count", 0,
+		"The number of shards of namespaces distributed among the replicas by Leases. Zero or one disables sharding. "+
+			"Requires --leader-elect=false.")
+	fs.DurationVar(&f.startupRefreshJitter, "startup-refresh-jitter", 0,
+		"The maximum random delay of the refreshes due when the controller starts or acquires a shard. Defaults to 5m, and 0 disables the jitter.")
+	fs.BoolVar(&f.skipConnectivityCheck, "skip-connectivity-check", false,
+		"Make the controller ready without reaching STS and IAM Credentials, e.g. in air-gapped test setups.")
+}
+
+// recordSet must be called after the flags are parsed.
+func (f *controllerFlags) recordSet(fs *flag.FlagSet) {
+	f.set = make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { f.set[fl.Name] = true })
+}
+
+func (f *controllerFlags) override(c *examplev1alpha1.ControllerConfig) {
+	if f.set["inject-image-pull-secrets-by-default"] {
+		c.Features.InjectImagePullSecretsByDefault = f.injectByDefault
+	}
+	if f.set["allow-local-subject-token-sources"] {
+		c.Features.AllowLocalSubjectTokenSources = f.allowLocalSubjectTokenSources
+	}
+	if f.set["sts-endpoint"] {
+		c.Endpoints.STS = f.stsEndpoint
+	}
+	if f.set["iamcredentials-endpoint"] {
+		c.Endpoints.IAMCredentials = f.iamCredentialsEndpoint
+	}
+	if f.set["extra-registries"] {
+		c.ExtraRegistries = splitNonEmpty(f.extraRegistries)
+	}
+	if f.set["skip-requester-authorization"] {
+		c.Features.SkipRequesterAuthorization = f.skipRequesterAuthorization
+	}
+	if f.set["max-concurrent-reconciles"] {
+		c.MaxConcurrentReconciles = f.maxConcurrentReconciles
+	}
+	if f.set["shard-count"] {
+		c.ShardCount = f.shardCount
+	}
+	if f.set["startup-refresh-jitter"] {
+		c.StartupRefreshJitter = &metav1.Duration{Duration: f.startupRefreshJitter}
+	}
+	if f.set["skip-connectivity-check"] {
+		c.HealthChecks.SkipConnectivityCheck = f.skipConnectivityCheck
+	}
+	if f.set["watch-namespaces"] {
+		c.WatchNamespaces = splitNonEmpty(f.watchNamespaces)
+	}
+}
+
+// loadControllerConfig loads the file if path is not empty, overrides it by the flags and validates it.
+func loadControllerConfig(scheme *runtime.Scheme, path string, flags *controllerFlags) (*examplev1alpha1.ControllerConfig, error) {
+	var c examplev1alpha1.ControllerConfig
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// Reject unknown fields because a typo silently falls back to the default.
+		codecs := serializer.NewCodecFactory(scheme, serializer.EnableStrict)
+		if err := runtime.DecodeInto(codecs.UniversalDecoder(), b, &c); err != nil {
+			return nil, fmt.Errorf("could not decode %s: %w", path, err)
+		}
+	}
+	flags.override(&c)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func settingsFromConfig(c *examplev1alpha1.ControllerConfig) controllers.Settings {
+	s := controllers.Settings{
+		DefaultRegistries:             c.DefaultRegistries,
+		ExtraRegistries:               c.ExtraRegistries,
+		DefaultScopes:                 c.DefaultScopes,
+		StsEndpoint:                   c.Endpoints.STS,
+		IamCredentialsEndpoint:        c.Endpoints.IAMCredentials,
+		AllowLocalSubjectTokenSources: c.Features.AllowLocalSubjectTokenSources,
+		InjectByDefault:               c.Features.InjectImagePullSecretsByDefault,
+		SkipRequesterAuthorization:    c.Features.SkipRequesterAuthorization,
+		PerProjectRequestsPerMinute:   c.RateLimit.PerProjectRequestsPerMinute,
+		PerProjectBurst:               c.RateLimit.PerProjectBurst,
+		SkipConnectivityCheck:         c.HealthChecks.SkipConnectivityCheck,
+	}
+	if c.RefreshMargin != nil {
+		s.RefreshMargin = c.RefreshMargin.Duration
+	}
+	if p := c.HealthChecks.ExpiredCredentialsThresholdPercent; p != nil {
+		threshold := *p
+		s.ExpiredCredentialsThresholdPercent = &threshold
+	}
+	if c.StartupRefreshJitter != nil {
+		jitter := c.StartupRefreshJitter.Duration
+		s.StartupRefreshJitter = &jitter
+	}
+	return s
+}
+
+// configReloader applies the reloadable fields of the configuration file when it is modified.
+// It runs in all replicas because the webhook is served by all of them.
+type configReloader struct {
+	scheme     *runtime.Scheme
+	path       string
+	flags      *controllerFlags
+	reconciler *controllers.ImagePullSecretReconciler
+
+	// startup is the configuration which the manager runs with. The restart-only fields are compared with it, not the last reload.
+	startup *examplev1alpha1.ControllerConfig
+	modTime time.Time
+}
+
+func newConfigReloader(scheme *runtime.Scheme, path string, flags *controllerFlags, reconciler *controllers.ImagePullSecretReconciler, startup *examplev1alpha1.ControllerConfig) (*configReloader, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &configReloader{
+		scheme:     scheme,
+		path:       path,
+		flags:      flags,
+		reconciler: reconciler,
+		startup:    startup,
+		modTime:    fi.ModTime(),
+	}, nil
+}
+
+// Start implements manager.Runnable.
+func (r *configReloader) Start(ctx context.Context) error {
+	ticker := time.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.reload()
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (r *configReloader) NeedLeaderElection() bool {
+	return false
+}
+
+func (r *configReloader) reload() {
+	// The file in a mounted ConfigMap is a symlink which is replaced on update, so stat follows it.
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		configLog.Error(err, "unable to stat the configuration file", "path", r.path)
+		return
+	}
+	if fi.ModTime().Equal(r.modTime) {
+		return
+	}
+	r.modTime = fi.ModTime()
+
+	c, err := loadControllerConfig(r.scheme, r.path, r.flags)
+	if err != nil {
+		configLog.Error(err, "keep the current configuration because the modified one is invalid", "path", r.path)
+		return
+	}
+	if !equality.Semantic.DeepEqual(r.startup.ControllerManagerConfigurationSpec, c.ControllerManagerConfigurationSpec) ||
+		r.startup.MaxConcurrentReconciles != c.MaxConcurrentReconciles ||
+		r.startup.ShardCount != c.ShardCount ||
+		!equality.Semantic.DeepEqual(r.startup.WatchNamespaces, c.WatchNamespaces) {
+		configLog.Info("the manager options, maxConcurrentReconciles, shardCount and watchNamespaces take effect after restart", "path", r.path)
+	}
+	r.reconciler.SetSettings(settingsFromConfig(c))
+	configLog.Info("reloaded the configuration", "path", r.path)
+}
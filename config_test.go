@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLoadControllerConfigExample(t *testing.T) {
+	c, err := loadControllerConfig(scheme, "config/manager/controller_manager_config.yaml", &controllerFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Health.HealthProbeBindAddress != ":8081" {
+		t.Errorf("want the probe address of the manager, got %q", c.Health.HealthProbeBindAddress)
+	}
+	if p := c.HealthChecks.ExpiredCredentialsThresholdPercent; p == nil || *p != 50 {
+		t.Errorf("want the expired credentials threshold 50, got %v", p)
+	}
+}
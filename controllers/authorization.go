@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+// RequesterAnnotation holds the JSON of authentication/v1 UserInfo of the user who created or last changed the spec.
+// It is set by the mutating webhook, and users can't forge it.
+const RequesterAnnotation = "image-pull-secret.apstn.dev/requester"
+
+// Reasons of the RequesterAuthorized condition. They are also used by the Ready condition.
+const (
+	reasonRequesterAuthorized = "Authorized"
+	reasonRequesterUnknown    = "RequesterUnknown"
+	reasonRequesterForbidden  = "RequesterForbidden"
+)
+
+// requesterRecheckInterval is how often a forbidden ImagePullSecret is checked again,
+// because granting the permission doesn't change the ImagePullSecret.
+const requesterRecheckInterval = 10 * time.Minute
+
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// requesterUnauthorizedError is returned if the requester may not request tokens of spec.serviceAccountName.
+type requesterUnauthorizedError struct {
+	reason  string
+	message string
+}
+
+func (e *requesterUnauthorizedError) Error() string {
+	return e.message
+}
+
+// requesterPermission is what the requester must be allowed to do by itself, because the controller does it with its own permission.
+type requesterPermission struct {
+	verb, resource, subresource, name string
+}
+
+func (p requesterPermission) String() string {
+	resource := p.resource
+	if p.subresource != "" {
+		resource += "/" + p.subresource
+	}
+	return fmt.Sprintf("%s %s %s", p.verb, resource, p.name)
+}
+
+// requesterPermissions returns the permissions which the controller uses on behalf of the requester of res:
+// requesting tokens of spec.serviceAccountName, and reading spec.subjectToken.oidc.clientSecretRef
+// which is sent to the issuer chosen by the requester.
+func requesterPermissions(res *examplev1alpha1.ImagePullSecret) []requesterPermission {
+	var perms []requesterPermission
+	if res.Spec.ServiceAccountName != "" {
+		perms = append(perms, requesterPermission{verb: "create", resource: "serviceaccounts", subresource: "token", name: res.Spec.ServiceAccountName})
+	}
+	if st := res.Spec.SubjectToken; st != nil && st.OIDC != nil {
+		perms = append(perms, requesterPermission{verb: "get", resource: "secrets", name: st.OIDC.ClientSecretRef.Name})
+	}
+	return perms
+}
+
+// requesterAuthorizationEnabled reports whether authorizeRequester checks res.
+func (r *ImagePullSecretReconciler) requesterAuthorizationEnabled(res *examplev1alpha1.ImagePullSecret) bool {
+	return len(requesterPermissions(res)) > 0 && !r.Settings().SkipRequesterAuthorization
+}
+
+// authorizeRequester checks that the requester has requesterPermissions,
+// so that the controller doesn't request tokens or read Secrets on behalf of users who can't do it by themselves.
+// It fails closed if the requester is unknown.
+func (r *ImagePullSecretReconciler) authorizeRequester(ctx context.Context, res *examplev1alpha1.ImagePullSecret) error {
+	if !r.requesterAuthorizationEnabled(res) {
+		return nil
+	}
+
+	v, ok := res.Annotations[RequesterAnnotation]
+	if !ok {
+		return &requesterUnauthorizedError{
+			reason:  reasonRequesterUnknown,
+			message: fmt.Sprintf("annotation %s is missing, update the ImagePullSecret through the webhook to record the requester", RequesterAnnotation),
+		}
+	}
+	var user authenticationv1.UserInfo
+	if err := json.Unmarshal([]byte(v), &user); err != nil || user.Username == "" {
+		return &requesterUnauthorizedError{
+			reason:  reasonRequesterUnknown,
+			message: fmt.Sprintf("annotation %s is invalid", RequesterAnnotation),
+		}
+	}
+
+	for _, perm := range requesterPermissions(res) {
+		sar := &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   res.Namespace,
+					Verb:        perm.verb,
+					Resource:    perm.resource,
+					Subresource: perm.subresource,
+					Name:        perm.name,
+				},
+			},
+		}
+		if len(user.Extra) > 0 {
+			sar.Spec.Extra = make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+			for k, v := range user.Extra {
+				sar.Spec.Extra[k] = authorizationv1.ExtraValue(v)
+			}
+		}
+		resp, err := r.ClientSet.AuthorizationV1().SubjectAccessReviews().Create(ctx, sar, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("subjectaccessreviews.Create: %w", err)
+		}
+		if !resp.Status.Allowed {
+			msg := fmt.Sprintf("%s may not %s", user.Username, perm)
+			if resp.Status.Reason != "" {
+				msg += ": " + resp.Status.Reason
+			}
+			return &requesterUnauthorizedError{reason: reasonRequesterForbidden, message: msg}
+		}
+	}
+	return nil
+}
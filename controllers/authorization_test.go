@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+func TestRequesterPermissionsOIDCClientSecret(t *testing.T) {
+	res := &examplev1alpha1.ImagePullSecret{}
+	res.Namespace = "default"
+	res.Spec.SubjectToken = &examplev1alpha1.SubjectTokenSpec{OIDC: &examplev1alpha1.OIDCSubjectTokenSource{
+		Issuer:          "https://login.example.com/",
+		ClientSecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "oidc-client"}, Key: "secret"},
+	}}
+	want := []requesterPermission{{verb: "get", resource: "secrets", name: "oidc-client"}}
+	if got := requesterPermissions(res); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	r := &ImagePullSecretReconciler{}
+	if !r.requesterAuthorizationEnabled(res) {
+		t.Error("want the requester authorization for the OIDC client secret")
+	}
+
+	// Without the requester authorization, the client secret is never read.
+	r.SetSettings(Settings{SkipRequesterAuthorization: true})
+	if _, err := r.subjectTokenSource(context.Background(), res, ""); err == nil {
+		t.Error("want error without the requester authorization")
+	}
+}
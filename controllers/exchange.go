@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
+	"golang.org/x/oauth2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+const defaultCredentialConfigKey = "credential-configuration.json"
+
+// exchange is the resolved parameters of the token exchange from either the spec or the credential configuration.
+type exchange struct {
+	// audience is the full resource name of the workload identity pool provider.
+	audience               string
+	subjectTokenType       string
+	stsEndpoint            string
+	gsaEmail               string
+	iamCredentialsEndpoint string
+	// externalAccount is set if the credential configuration is used.
+	externalAccount *tokensource.ExternalAccountConfig
+}
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get
+
+func (r *ImagePullSecretReconciler) resolveExchange(ctx context.Context, res *examplev1alpha1.ImagePullSecret) (*exchange, error) {
+	ex, err := r.resolveCredentialConfig(ctx, res)
+	if err != nil {
+		return nil, err
+	}
+	if ex == nil {
+		ex = &exchange{
+			audience: fmt.Sprintf("//iam.googleapis.com/%s", res.Spec.WorkloadIdentityPoolProvider),
+			gsaEmail: res.Spec.GsaEmail,
+		}
+	}
+
+	// Endpoints in the spec take precedence over the credential configuration, and then the controller defaults.
+	settings := r.Settings()
+	if ex.stsEndpoint == "" {
+		ex.stsEndpoint = settings.StsEndpoint
+	}
+	if ex.iamCredentialsEndpoint == "" {
+		ex.iamCredentialsEndpoint = settings.IamCredentialsEndpoint
+	}
+	if e := res.Spec.Endpoints; e != nil {
+		if e.STS != "" {
+			ex.stsEndpoint = e.STS
+		}
+		if e.IAMCredentials != "" {
+			ex.iamCredentialsEndpoint = e.IAMCredentials
+		}
+	}
+	// The credential configuration is also written by tenants, so the resolved endpoints are checked as the spec.
+	if err := validateEndpoints("endpoints", ex.stsEndpoint, ex.iamCredentialsEndpoint); err != nil {
+		return nil, err
+	}
+	return ex, nil
+}
+
+// validateEndpoints checks the non-empty endpoints as ControllerConfig does,
+// so that tenants can't send the tokens in cleartext or to a URL which isn't an endpoint.
+func validateEndpoints(field, sts, iamCredentials string) error {
+	if sts != "" {
+		if err := examplev1alpha1.ValidateStsEndpoint(sts); err != nil {
+			return &tokensource.PermanentError{Err: fmt.Errorf("%s.sts: %w", field, err)}
+		}
+	}
+	if iamCredentials != "" {
+		if err := examplev1alpha1.ValidateIamCredentialsEndpoint(iamCredentials); err != nil {
+			return &tokensource.PermanentError{Err: fmt.Errorf("%s.iamCredentials: %w", field, err)}
+		}
+	}
+	return nil
+}
+
+// resolveCredentialConfig returns the exchange described in the credential configuration.
+// It returns nil if spec.credentialConfig is not set.
+func (r *ImagePullSecretReconciler) resolveCredentialConfig(ctx context.Context, res *examplev1alpha1.ImagePullSecret) (*exchange, error) {
+	if res.Spec.CredentialConfig == nil {
+		return nil, nil
+	}
+
+	ref := res.Spec.CredentialConfig
+	key := ref.Key
+	if key == "" {
+		key = defaultCredentialConfigKey
+	}
+	cm, err := r.ClientSet.CoreV1().ConfigMaps(res.Namespace).Get(ctx, ref.ConfigMapRef.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	b, ok := cm.Data[key]
+	if !ok {
+		return nil, &tokensource.PermanentError{Err: fmt.Errorf("key %q is not found in ConfigMap %s/%s", key, res.Namespace, ref.ConfigMapRef.Name)}
+	}
+	c, err := tokensource.ParseExternalAccountConfig([]byte(b))
+	if err != nil {
+		return nil, &tokensource.PermanentError{Err: err}
+	}
+
+	stsEndpoint, err := c.StsEndpoint()
+	if err != nil {
+		return nil, &tokensource.PermanentError{Err: err}
+	}
+	gsaEmail, err := c.ServiceAccountEmail()
+	if err != nil {
+		return nil, &tokensource.PermanentError{Err: err}
+	}
+	iamCredentialsEndpoint, err := c.IamCredentialsEndpoint()
+	if err != nil {
+		return nil, &tokensource.PermanentError{Err: err}
+	}
+	return &exchange{
+		audience:               c.Audience,
+		subjectTokenType:       c.SubjectTokenType,
+		stsEndpoint:            stsEndpoint,
+		gsaEmail:               gsaEmail,
+		iamCredentialsEndpoint: iamCredentialsEndpoint,
+		externalAccount:        c,
+	}, nil
+}
+
+// credentialSourceTokenSource returns the token source of credential_source in the credential configuration.
+// It runs in the controller like file and executable subject token sources, so it is allowed by the same flag.
+func (r *ImagePullSecretReconciler) credentialSourceTokenSource(ctx context.Context, c *tokensource.ExternalAccountConfig) (oauth2.TokenSource, error) {
+	if !r.Settings().AllowLocalSubjectTokenSources {
+		return nil, &tokensource.PermanentError{Err: fmt.Errorf("credential_source is not allowed by the controller, set spec.serviceAccountName or spec.subjectToken")}
+	}
+	ts, err := c.CredentialSourceTokenSource(ctx, r.transport)
+	if err != nil {
+		return nil, &tokensource.PermanentError{Err: err}
+	}
+	return ts, nil
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"testing"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+func TestValidateEndpoints(t *testing.T) {
+	tests := []struct {
+		desc     string
+		sts, iam string
+		wantErr  bool
+	}{
+		{"defaults", "", "", false},
+		{"private service connect", "https://sts-xyz.p.googleapis.com/", "iamcredentials-xyz.p.googleapis.com:443", false},
+		{"cleartext sts", "http://sts.example.internal/", "", true},
+		{"sts without host", "https:///v1/token", "", true},
+		{"iam url", "", "https://iamcredentials.googleapis.com/", true},
+		{"iam without port", "", "iamcredentials.googleapis.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			res := &examplev1alpha1.ImagePullSecret{}
+			res.Spec.ServiceAccountName = "default"
+			res.Spec.GsaEmail = "puller@project.iam.gserviceaccount.com"
+			res.Spec.WorkloadIdentityPoolProvider = "projects/123/locations/global/workloadIdentityPools/pool/providers/gke"
+			res.Spec.Endpoints = &examplev1alpha1.EndpointsSpec{STS: tt.sts, IAMCredentials: tt.iam}
+			if err := validate(res); (err != nil) != tt.wantErr {
+				t.Errorf("want error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+// formatter renders the access token for the registries in a file format read by a consumer.
+type formatter interface {
+	format(gsaEmail, accessToken string, registries []string) ([]byte, error)
+	// defaultKey is the file name which the consumer reads.
+	defaultKey() string
+}
+
+var formatters = map[examplev1alpha1.OutputFormat]formatter{
+	examplev1alpha1.OutputDockerConfigJson:    dockerConfigJsonFormat{},
+	examplev1alpha1.OutputPodmanAuthJson:      authJsonFormat{key: "auth.json"},
+	examplev1alpha1.OutputHelmRegistryConfig:  authJsonFormat{key: "config.json"},
+	examplev1alpha1.OutputContainerdHostsToml: hostsTomlFormat{},
+}
+
+// dockerConfigJsonFormat is .dockerconfigjson of kubernetes.io/dockerconfigjson Secrets, which kubelet reads.
+type dockerConfigJsonFormat struct{}
+
+func (dockerConfigJsonFormat) format(gsaEmail, accessToken string, registries []string) ([]byte, error) {
+	var cfg dockerCfg
+	cfg.addAuths("", gsaEmail, accessToken, registries)
+	return cfg.marshal()
+}
+
+func (dockerConfigJsonFormat) defaultKey() string {
+	return "config.json"
+}
+
+// authJsonFormat is the auth field of config.json, which containers-auth.json(5) and Helm read
+// without username and password.
+type authJsonFormat struct {
+	key string
+}
+
+func (authJsonFormat) format(_, accessToken string, registries []string) ([]byte, error) {
+	type auth struct {
+		Auth string `json:"auth"`
+	}
+	cfg := struct {
+		Auths map[string]auth `json:"auths"`
+	}{Auths: make(map[string]auth, len(registries))}
+	for _, reg := range registries {
+		cfg.Auths[reg] = auth{Auth: base64.StdEncoding.EncodeToString([]byte(dockerConfigUsername + ":" + accessToken))}
+	}
+	j, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+	return j, nil
+}
+
+func (f authJsonFormat) defaultKey() string {
+	return f.key
+}
+
+// hostsTomlFormat is the host entries of hosts.toml of containerd which send the access token by the Authorization header.
+// containerd reads a hosts.toml per registry, so the node bootstrapper places each entry in certs.d/<registry>/hosts.toml.
+type hostsTomlFormat struct{}
+
+func (hostsTomlFormat) format(_, accessToken string, registries []string) ([]byte, error) {
+	var b bytes.Buffer
+	for i, reg := range registries {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		// %q is a valid TOML basic string for hostnames and access tokens.
+		host := fmt.Sprintf("%q", "https://"+reg)
+		fmt.Fprintf(&b, "[host.%s]\n", host)
+		fmt.Fprintf(&b, "  capabilities = [\"pull\", \"resolve\"]\n")
+		fmt.Fprintf(&b, "  [host.%s.header]\n", host)
+		fmt.Fprintf(&b, "    Authorization = %q\n", "Bearer "+accessToken)
+	}
+	return b.Bytes(), nil
+}
+
+func (hostsTomlFormat) defaultKey() string {
+	return "hosts.toml"
+}
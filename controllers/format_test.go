@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+func TestFormatters(t *testing.T) {
+	registries := []string{"gcr.io", "us-docker.pkg.dev"}
+	tests := []struct {
+		format examplev1alpha1.OutputFormat
+		want   string
+	}{
+		{examplev1alpha1.OutputDockerConfigJson, `{"auths":{"gcr.io":{"username":"oauth2accesstoken","password":"ya29.x","email":"puller@project.iam.gserviceaccount.com"},"us-docker.pkg.dev":{"username":"oauth2accesstoken","password":"ya29.x","email":"puller@project.iam.gserviceaccount.com"}}}`},
+		// base64("oauth2accesstoken:ya29.x")
+		{examplev1alpha1.OutputPodmanAuthJson, `{"auths":{"gcr.io":{"auth":"b2F1dGgyYWNjZXNzdG9rZW46eWEyOS54"},"us-docker.pkg.dev":{"auth":"b2F1dGgyYWNjZXNzdG9rZW46eWEyOS54"}}}`},
+		{examplev1alpha1.OutputHelmRegistryConfig, `{"auths":{"gcr.io":{"auth":"b2F1dGgyYWNjZXNzdG9rZW46eWEyOS54"},"us-docker.pkg.dev":{"auth":"b2F1dGgyYWNjZXNzdG9rZW46eWEyOS54"}}}`},
+		{examplev1alpha1.OutputContainerdHostsToml, `[host."https://gcr.io"]
+  capabilities = ["pull", "resolve"]
+  [host."https://gcr.io".header]
+    Authorization = "Bearer ya29.x"
+
+[host."https://us-docker.pkg.dev"]
+  capabilities = ["pull", "resolve"]
+  [host."https://us-docker.pkg.dev".header]
+    Authorization = "Bearer ya29.x"
+`},
+	}
+	for _, tt := range tests {
+		got, err := formatters[tt.format].format("puller@project.iam.gserviceaccount.com", "ya29.x", registries)
+		if err != nil {
+			t.Errorf("%s: %v", tt.format, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.format, tt.want, got)
+		}
+	}
+}
+
+func TestRenderOutputs(t *testing.T) {
+	res := &examplev1alpha1.ImagePullSecret{Spec: examplev1alpha1.ImagePullSecretSpec{
+		SecretName: "image-pull-secret",
+		Outputs: []examplev1alpha1.Output{
+			{Format: examplev1alpha1.OutputPodmanAuthJson, Target: examplev1alpha1.OutputTarget{Name: "build"}},
+			{Format: examplev1alpha1.OutputContainerdHostsToml, Target: examplev1alpha1.OutputTarget{Name: "build"}},
+			{Format: examplev1alpha1.OutputHelmRegistryConfig, Target: examplev1alpha1.OutputTarget{Kind: examplev1alpha1.OutputConfigMap, Name: "helm"}, Key: "registry.json"},
+		},
+	}}
+	if err := validateOutputs(res); err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := renderOutputs(res, "ya29.x", []string{"gcr.io"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[examplev1alpha1.OutputTarget][]string{}
+	for target, data := range rendered {
+		for key := range data {
+			keys[target] = append(keys[target], key)
+		}
+	}
+	build := examplev1alpha1.OutputTarget{Kind: examplev1alpha1.OutputSecret, Name: "build"}
+	helm := examplev1alpha1.OutputTarget{Kind: examplev1alpha1.OutputConfigMap, Name: "helm"}
+	if len(keys) != 2 || len(keys[build]) != 2 || !reflect.DeepEqual(keys[helm], []string{"registry.json"}) {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+
+	// Two outputs can't write the same key of a target.
+	res.Spec.Outputs = append(res.Spec.Outputs, examplev1alpha1.Output{Format: examplev1alpha1.OutputDockerConfigJson, Target: examplev1alpha1.OutputTarget{Kind: examplev1alpha1.OutputConfigMap, Name: "helm"}, Key: "registry.json"})
+	if err := validateOutputs(res); err == nil {
+		t.Error("want error for the duplicate key")
+	}
+	res.Spec.Outputs = []examplev1alpha1.Output{{Format: examplev1alpha1.OutputPodmanAuthJson, Target: examplev1alpha1.OutputTarget{Name: "image-pull-secret"}}}
+	if err := validateOutputs(res); err == nil {
+		t.Error("want error for spec.secretName")
+	}
+}
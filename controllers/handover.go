@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
+)
+
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;update
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=delete
+
+const (
+	// defaultHandoverGracePeriod is how long the previous credential is kept by default.
+	// It covers the Secret propagation to kubelets and the image pulls of starting Pods.
+	defaultHandoverGracePeriod = 10 * time.Minute
+
+	// aliasPrefix makes the alias keys of the registries in .dockerconfigjson.
+	// kubelet normalizes the keys, so the alias matches the same registry as the plain hostname.
+	aliasPrefix = "https://"
+)
+
+func handoverGracePeriod(spec *examplev1alpha1.HandoverSpec) time.Duration {
+	if spec.GracePeriod != nil {
+		return spec.GracePeriod.Duration
+	}
+	return defaultHandoverGracePeriod
+}
+
+func validateHandover(spec *examplev1alpha1.HandoverSpec) error {
+	if spec.GracePeriod != nil && spec.GracePeriod.Duration <= 0 {
+		return &tokensource.PermanentError{Err: fmt.Errorf("spec.handover.gracePeriod must be positive: %v", spec.GracePeriod.Duration)}
+	}
+	if len(spec.ServiceAccounts) > 0 && spec.Mode != examplev1alpha1.HandoverVersioned {
+		return &tokensource.PermanentError{Err: fmt.Errorf("spec.handover.serviceAccounts is only valid in %s mode", examplev1alpha1.HandoverVersioned)}
+	}
+	return nil
+}
+
+// currentSecretName returns the name of the Secret which holds the current credential of res.
+func currentSecretName(res *examplev1alpha1.ImagePullSecret) string {
+	if h := res.Spec.Handover; h != nil && h.Mode == examplev1alpha1.HandoverVersioned && res.Status.CurrentSecretName != "" {
+		return res.Status.CurrentSecretName
+	}
+	return res.Spec.SecretName
+}
+
+// versionedSecretName returns <secretName>-<hash> of the content, so the same content always has the same name.
+func versionedSecretName(secretName string, dockerConfigJson []byte) string {
+	sum := sha256.Sum256(dockerConfigJson)
+	return fmt.Sprintf("%s-%s", secretName, hex.EncodeToString(sum[:])[:10])
+}
+
+// writeCredential writes the access token to the Secret according to spec.handover and records the handover in the status.
+func (r *ImagePullSecretReconciler) writeCredential(ctx context.Context, res *examplev1alpha1.ImagePullSecret, token *oauth2.Token, now time.Time) error {
+	accessToken := token.AccessToken
+	registries := r.registries(res)
+	spec := res.Spec.Handover
+	if spec == nil {
+		b, err := dockerConfigJsonFormat{}.format(res.Spec.GsaEmail, accessToken, registries)
+		if err != nil {
+			return err
+		}
+		if err := r.upsertSecret(ctx, r.dockerConfigSecret(res, res.Spec.SecretName, b, token)); err != nil {
+			return err
+		}
+		return r.switchCurrentSecret(ctx, res, res.Spec.SecretName, now)
+	}
+
+	switch spec.Mode {
+	case examplev1alpha1.HandoverAlias:
+		previous, err := r.currentAccessToken(ctx, res.Namespace, res.Spec.SecretName)
+		if err != nil {
+			return err
+		}
+		var cfg dockerCfg
+		cfg.addAuths("", res.Spec.GsaEmail, accessToken, registries)
+		if previous != "" && previous != accessToken {
+			cfg.addAuths(aliasPrefix, res.Spec.GsaEmail, previous, registries)
+			res.Status.HandoverDeadline = &metav1.Time{Time: now.Add(handoverGracePeriod(spec))}
+		}
+		b, err := cfg.marshal()
+		if err != nil {
+			return err
+		}
+		if err := r.upsertSecret(ctx, r.dockerConfigSecret(res, res.Spec.SecretName, b, token)); err != nil {
+			return err
+		}
+		return r.switchCurrentSecret(ctx, res, res.Spec.SecretName, now)
+	case examplev1alpha1.HandoverVersioned:
+		b, err := dockerConfigJsonFormat{}.format(res.Spec.GsaEmail, accessToken, registries)
+		if err != nil {
+			return err
+		}
+		secret := r.dockerConfigSecret(res, versionedSecretName(res.Spec.SecretName, b), b, token)
+		// The versioned Secrets are garbage-collected with res.
+		if err := controllerutil.SetControllerReference(res, secret, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.upsertSecret(ctx, secret); err != nil {
+			return err
+		}
+		if err := r.switchServiceAccounts(ctx, res, secret.Name); err != nil {
+			return err
+		}
+		return r.switchCurrentSecret(ctx, res, secret.Name, now)
+	default:
+		return &tokensource.PermanentError{Err: fmt.Errorf("unknown spec.handover.mode: %q", spec.Mode)}
+	}
+}
+
+// switchCurrentSecret records name as the current Secret.
+// The replaced versioned Secret is kept until the grace period expires, and the one replaced before it is deleted now.
+func (r *ImagePullSecretReconciler) switchCurrentSecret(ctx context.Context, res *examplev1alpha1.ImagePullSecret, name string, now time.Time) error {
+	old := res.Status.CurrentSecretName
+	res.Status.CurrentSecretName = name
+	if old == "" || old == name || old == res.Spec.SecretName {
+		return nil
+	}
+	if prev := res.Status.PreviousSecretName; prev != "" && prev != name {
+		if err := r.deleteVersionedSecret(ctx, res, prev); err != nil {
+			return err
+		}
+	}
+	gracePeriod := defaultHandoverGracePeriod
+	if res.Spec.Handover != nil {
+		gracePeriod = handoverGracePeriod(res.Spec.Handover)
+	}
+	res.Status.PreviousSecretName = old
+	res.Status.HandoverDeadline = &metav1.Time{Time: now.Add(gracePeriod)}
+	return nil
+}
+
+// switchServiceAccounts replaces the reference to the current Secret with name in imagePullSecrets of the ServiceAccounts.
+// Each ServiceAccount is switched by a single update, so Pods created at any moment refer to exactly one valid Secret.
+func (r *ImagePullSecretReconciler) switchServiceAccounts(ctx context.Context, res *examplev1alpha1.ImagePullSecret, name string) error {
+	old := currentSecretName(res)
+	for _, saName := range res.Spec.Handover.ServiceAccounts {
+		// Use the clientset not to cache all ServiceAccounts in the cluster.
+		sa, err := r.ClientSet.CoreV1().ServiceAccounts(res.Namespace).Get(ctx, saName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("ServiceAccount %s: %w", saName, err)
+		}
+		if !replaceImagePullSecret(sa, old, name) {
+			continue
+		}
+		if _, err := r.ClientSet.CoreV1().ServiceAccounts(res.Namespace).Update(ctx, sa, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("ServiceAccount %s: %w", saName, err)
+		}
+	}
+	return nil
+}
+
+// replaceImagePullSecret replaces old with name in imagePullSecrets of sa, or appends name if old is absent.
+// It reports whether sa is changed.
+func replaceImagePullSecret(sa *corev1.ServiceAccount, old, name string) bool {
+	refs := make([]corev1.LocalObjectReference, 0, len(sa.ImagePullSecrets)+1)
+	found := false
+	for _, ref := range sa.ImagePullSecrets {
+		switch ref.Name {
+		case name:
+			if found {
+				continue
+			}
+			found = true
+		case old:
+			if found {
+				continue
+			}
+			found = true
+			ref.Name = name
+		}
+		refs = append(refs, ref)
+	}
+	if !found {
+		refs = append(refs, corev1.LocalObjectReference{Name: name})
+	}
+	changed := len(refs) != len(sa.ImagePullSecrets)
+	for i := 0; !changed && i < len(refs); i++ {
+		changed = refs[i] != sa.ImagePullSecrets[i]
+	}
+	sa.ImagePullSecrets = refs
+	return changed
+}
+
+// finishHandover removes the previous credential if the grace period expired.
+// It reports whether the status is changed.
+func (r *ImagePullSecretReconciler) finishHandover(ctx context.Context, res *examplev1alpha1.ImagePullSecret, now time.Time) (bool, error) {
+	deadline := res.Status.HandoverDeadline
+	if deadline == nil || now.Before(deadline.Time) {
+		return false, nil
+	}
+	if prev := res.Status.PreviousSecretName; prev != "" {
+		if err := r.deleteVersionedSecret(ctx, res, prev); err != nil {
+			return false, err
+		}
+	} else if err := r.removeAliases(ctx, res); err != nil {
+		return false, err
+	}
+	res.Status.PreviousSecretName = ""
+	res.Status.HandoverDeadline = nil
+	return true, nil
+}
+
+// removeAliases rewrites the Secret without the alias entries of the previous access token.
+func (r *ImagePullSecretReconciler) removeAliases(ctx context.Context, res *examplev1alpha1.ImagePullSecret) error {
+	secret, err := r.ClientSet.CoreV1().Secrets(res.Namespace).Get(ctx, res.Spec.SecretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cfg, err := parseDockerConfigJson(secret.Data[corev1.DockerConfigJsonKey])
+	if err != nil {
+		return fmt.Errorf("Secret %s: %w", secret.Name, err)
+	}
+	changed := false
+	for key := range cfg.Auths {
+		if strings.HasPrefix(key, aliasPrefix) {
+			delete(cfg.Auths, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	b, err := cfg.marshal()
+	if err != nil {
+		return err
+	}
+	secret.Data[corev1.DockerConfigJsonKey] = b
+	secret, err = r.ClientSet.CoreV1().Secrets(res.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	r.written.record(secret)
+	res.Status.SecretHash = secretHash(secret.Data)
+	return nil
+}
+
+// currentAccessToken returns the access token in the Secret, or empty if the Secret doesn't exist.
+func (r *ImagePullSecretReconciler) currentAccessToken(ctx context.Context, namespace, name string) (string, error) {
+	secret, err := r.ClientSet.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return accessTokenOf(secret), nil
+}
+
+// accessTokenOf returns the access token in .dockerconfigjson of the Secret, or empty if it is broken.
+func accessTokenOf(secret *corev1.Secret) string {
+	cfg, err := parseDockerConfigJson(secret.Data[corev1.DockerConfigJsonKey])
+	if err != nil {
+		// The Secret is overwritten anyway, so the broken content is not kept as the previous credential.
+		return ""
+	}
+	for key, auth := range cfg.Auths {
+		if !strings.HasPrefix(key, aliasPrefix) && auth.Username == dockerConfigUsername {
+			return auth.Password
+		}
+	}
+	return ""
+}
+
+// deleteVersionedSecret deletes the Secret if it is a versioned Secret of res.
+// Secrets which are not controlled by res, e.g. spec.secretName before Versioned mode is enabled, are left as is.
+func (r *ImagePullSecretReconciler) deleteVersionedSecret(ctx context.Context, res *examplev1alpha1.ImagePullSecret, name string) error {
+	secret, err := r.ClientSet.CoreV1().Secrets(res.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(secret, res) {
+		return nil
+	}
+	err = r.ClientSet.CoreV1().Secrets(res.Namespace).Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &secret.UID},
+	})
+	r.written.forget(types.NamespacedName{Namespace: res.Namespace, Name: name})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestReplaceImagePullSecret(t *testing.T) {
+	refs := func(names ...string) []corev1.LocalObjectReference {
+		var r []corev1.LocalObjectReference
+		for _, n := range names {
+			r = append(r, corev1.LocalObjectReference{Name: n})
+		}
+		return r
+	}
+	tests := []struct {
+		desc        string
+		before      []corev1.LocalObjectReference
+		want        []corev1.LocalObjectReference
+		wantChanged bool
+	}{
+		{"replace in place", refs("other", "pull-old", "another"), refs("other", "pull-new", "another"), true},
+		{"append if absent", refs("other"), refs("other", "pull-new"), true},
+		{"already switched", refs("pull-new"), refs("pull-new"), false},
+		{"drop old if both exist", refs("pull-new", "pull-old"), refs("pull-new"), true},
+	}
+	for _, tt := range tests {
+		sa := &corev1.ServiceAccount{ImagePullSecrets: tt.before}
+		changed := replaceImagePullSecret(sa, "pull-old", "pull-new")
+		if changed != tt.wantChanged || !reflect.DeepEqual(sa.ImagePullSecrets, tt.want) {
+			t.Errorf("%s: want %v (changed=%v), got %v (changed=%v)", tt.desc, tt.want, tt.wantChanged, sa.ImagePullSecrets, changed)
+		}
+	}
+}
+
+func TestVersionedSecretName(t *testing.T) {
+	a := versionedSecretName("pull", []byte(`{"auths":{"gcr.io":{"password":"a"}}}`))
+	b := versionedSecretName("pull", []byte(`{"auths":{"gcr.io":{"password":"b"}}}`))
+	if a == b {
+		t.Errorf("different contents must have different names: %s", a)
+	}
+	if a != versionedSecretName("pull", []byte(`{"auths":{"gcr.io":{"password":"a"}}}`)) {
+		t.Errorf("the same content must have the same name")
+	}
+	if len(a) != len("pull-")+10 {
+		t.Errorf("unexpected name: %s", a)
+	}
+}
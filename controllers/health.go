@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+const (
+	defaultStsEndpoint            = "https://sts.googleapis.com/"
+	defaultIamCredentialsEndpoint = "iamcredentials.googleapis.com:443"
+
+	// cacheSyncCheckTimeout keeps the probe responsive while the caches are syncing.
+	cacheSyncCheckTimeout = time.Second
+	// connectivityCheckTimeout is shorter than the default timeout of the readiness probe.
+	connectivityCheckTimeout = 5 * time.Second
+
+	// defaultExpiredCredentialsThresholdPercent is the percentage of expired credentials above which the controller is degraded.
+	defaultExpiredCredentialsThresholdPercent = 50
+)
+
+// healthState is what the health and readiness checks observe.
+type healthState struct {
+	cache           cache.Cache
+	secretInformers []toolscache.SharedIndexInformer
+	// elected is closed when this replica starts reconciling, i.e. it is the leader or leader election is disabled.
+	elected <-chan struct{}
+
+	mu sync.Mutex
+	// connected is true once STS and IAM Credentials are reached. Later outages don't make the replica unready,
+	// because the webhook doesn't depend on them and the failures are reported by the conditions.
+	connected bool
+}
+
+// elected reports whether this replica reconciles ImagePullSecrets.
+// Replicas waiting for the leader election only serve the webhook.
+func (r *ImagePullSecretReconciler) elected() bool {
+	select {
+	case <-r.health.elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// CacheSyncCheck is a readiness check which fails until the caches of the manager and the Secret metadata are synced.
+func (r *ImagePullSecretReconciler) CacheSyncCheck(req *http.Request) error {
+	if r.health.cache == nil {
+		return fmt.Errorf("the controller is not set up")
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), cacheSyncCheckTimeout)
+	defer cancel()
+	if !r.health.cache.WaitForCacheSync(ctx) {
+		return fmt.Errorf("the cache is not synced")
+	}
+	// The Secret metadata informers run only in the elected replica.
+	if !r.elected() {
+		return nil
+	}
+	for _, informer := range r.health.secretInformers {
+		if !informer.HasSynced() {
+			return fmt.Errorf("the cache of the Secrets is not synced")
+		}
+	}
+	return nil
+}
+
+// ConnectivityCheck is a readiness check which fails until STS and IAM Credentials are reached through the transport.
+// Any HTTP response counts because the check doesn't authenticate.
+func (r *ImagePullSecretReconciler) ConnectivityCheck(req *http.Request) error {
+	settings := r.Settings()
+	if settings.SkipConnectivityCheck {
+		return nil
+	}
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+	if r.health.connected {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), connectivityCheckTimeout)
+	defer cancel()
+	for _, endpoint := range connectivityCheckURLs(&settings) {
+		if err := r.reach(ctx, endpoint); err != nil {
+			return err
+		}
+	}
+	r.health.connected = true
+	return nil
+}
+
+// connectivityCheckURLs returns the URLs of the STS and IAM Credentials endpoints.
+func connectivityCheckURLs(s *Settings) []string {
+	sts := s.StsEndpoint
+	if sts == "" {
+		sts = defaultStsEndpoint
+	}
+	iamCredentials := s.IamCredentialsEndpoint
+	if iamCredentials == "" {
+		iamCredentials = defaultIamCredentialsEndpoint
+	}
+	return []string{sts, "https://" + strings.TrimSuffix(iamCredentials, ":443") + "/"}
+}
+
+func (r *ImagePullSecretReconciler) reach(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.transport.HTTPClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach %s: %w", url, err)
+	}
+	return resp.Body.Close()
+}
+
+// CredentialsCheck is a health check which reports degraded when the fraction of the ImagePullSecrets
+// reconciled by this replica whose credentials are expired exceeds the threshold.
+func (r *ImagePullSecretReconciler) CredentialsCheck(req *http.Request) error {
+	if !r.elected() {
+		return nil
+	}
+	var list examplev1alpha1.ImagePullSecretList
+	if err := r.List(req.Context(), &list); err != nil {
+		return err
+	}
+	settings := r.Settings()
+	expired, total := expiredCredentials(list.Items, time.Now(), func(namespace string) bool {
+		return r.inScope(namespace) && r.ownsShard(namespace)
+	})
+	if threshold := settings.expiredCredentialsThresholdPercent(); total > 0 && expired*100 > threshold*total {
+		return fmt.Errorf("%d of %d ImagePullSecrets have expired credentials, above the threshold of %d%%", expired, total, threshold)
+	}
+	return nil
+}
+
+// expiredCredentials counts the minted credentials and the expired ones among them in the namespaces for which owns is true.
+func expiredCredentials(items []examplev1alpha1.ImagePullSecret, now time.Time, owns func(namespace string) bool) (expired, total int) {
+	for i := range items {
+		res := &items[i]
+		if res.Status.ExpiresAt.IsZero() || !owns(res.Namespace) {
+			continue
+		}
+		total++
+		if !now.Before(res.Status.ExpiresAt.Time) {
+			expired++
+		}
+	}
+	return expired, total
+}
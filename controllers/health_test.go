@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+func TestExpiredCredentials(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	item := func(namespace string, expiresAt time.Time) examplev1alpha1.ImagePullSecret {
+		var res examplev1alpha1.ImagePullSecret
+		res.Namespace = namespace
+		res.Status.ExpiresAt = metav1.NewTime(expiresAt)
+		return res
+	}
+	items := []examplev1alpha1.ImagePullSecret{
+		item("a", now.Add(-time.Minute)),
+		item("a", now.Add(time.Minute)),
+		item("a", time.Time{}), // not minted yet
+		item("b", now.Add(-time.Minute)),
+	}
+	expired, total := expiredCredentials(items, now, func(namespace string) bool { return namespace == "a" })
+	if expired != 1 || total != 2 {
+		t.Errorf("want 1 of 2 expired, got %d of %d", expired, total)
+	}
+}
+
+func TestExpiredCredentialsThresholdPercent(t *testing.T) {
+	if got := (&Settings{}).expiredCredentialsThresholdPercent(); got != defaultExpiredCredentialsThresholdPercent {
+		t.Errorf("want the default threshold, got %d", got)
+	}
+	// An explicit zero reports any expired credential instead of falling back to the default.
+	zero := 0
+	if got := (&Settings{ExpiredCredentialsThresholdPercent: &zero}).expiredCredentialsThresholdPercent(); got != 0 {
+		t.Errorf("want 0, got %d", got)
+	}
+}
+
+func TestConnectivityCheckURLs(t *testing.T) {
+	got := connectivityCheckURLs(&Settings{})
+	want := []string{"https://sts.googleapis.com/", "https://iamcredentials.googleapis.com/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	got = connectivityCheckURLs(&Settings{StsEndpoint: "https://sts-xyz.p.googleapis.com/", IamCredentialsEndpoint: "iamcredentials-xyz.p.googleapis.com:8443"})
+	want = []string{"https://sts-xyz.p.googleapis.com/", "https://iamcredentials-xyz.p.googleapis.com:8443/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -19,28 +19,70 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"net/url"
 	"os"
 	"time"
 
-	"github.com/apstndb/image-pull-secret-controller/controllers/internal/tokensource"
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
 	"golang.org/x/oauth2"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
 )
 
 const (
-	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
-	userInfoEmailScope = "https://www.googleapis.com/auth/userinfo.email"
+	devstorageReadOnlyScope    = "https://www.googleapis.com/auth/devstorage.read_only"
+	cloudPlatformReadOnlyScope = "https://www.googleapis.com/auth/cloud-platform.read-only"
+
+	// maxTokenLifetime is the upper limit of GenerateAccessToken.
+	maxTokenLifetime = 12 * time.Hour
+	// maxDelegates is the limit of the delegation chain length.
+	maxDelegates = 10
+)
+
+// defaultScopes are least privileged scopes to pull images from Container Registry and Artifact Registry.
+var defaultScopes = []string{devstorageReadOnlyScope, cloudPlatformReadOnlyScope}
+
+// Reasons of the Ready condition.
+const (
+	reasonMinted           = "Minted"
+	reasonTransientFailure = "TransientFailure"
+	reasonQuotaExceeded    = "QuotaExceeded"
+	reasonPermanentFailure = "PermanentFailure"
+)
+
+// Reasons of the Degraded condition.
+const (
+	reasonRefreshSucceeded  = "RefreshSucceeded"
+	reasonRefreshFailing    = "RefreshFailing"
+	reasonCredentialExpired = "CredentialExpired"
+)
+
+const (
+	// defaultRefreshMargin is how long before the expiry the credential is refreshed.
+	defaultRefreshMargin = 15 * time.Minute
+	// expiryWarningThreshold is the remaining lifetime of the last good credential
+	// below which refresh failures are reported as Warning events.
+	expiryWarningThreshold = 10 * time.Minute
 )
 
 // ImagePullSecretReconciler reconciles a ImagePullSecret object
@@ -48,10 +90,67 @@ type ImagePullSecretReconciler struct {
 	client.Client
 	Scheme    *runtime.Scheme
 	ClientSet *kubernetes.Clientset
+	Recorder  record.EventRecorder
+
+	// MaxConcurrentReconciles is the number of workers. Defaults to 1.
+	// The token exchanges are limited per GCP project regardless of it.
+	MaxConcurrentReconciles int
+	// WatchNamespaces restricts the namespaces in which ImagePullSecrets are reconciled. Empty means all namespaces.
+	// It must match the namespaces of the cache.
+	WatchNamespaces []string
+
+	// Sharding splits the namespaces among the replicas. Leader election must be disabled to use it.
+	Sharding ShardingOptions
+
+	// TransportOptions configures the proxy and TLS of outbound requests to STS, IAM Credentials and subject token sources.
+	TransportOptions TransportOptions
+
+	transport *tokensource.Transport
+	settings  settingsHolder
+	written   writtenSecrets
+	limiter   projectRateLimiter
+	shards    *shardManager
+	// shardEvents enqueues the ImagePullSecrets of newly acquired shards.
+	shardEvents chan event.GenericEvent
+	jitter      startupJitter
+	warmUp      warmUp
+	health      healthState
+}
+
+// TransportOptions are the options of the outbound transport. Zero values mean the defaults.
+type TransportOptions struct {
+	// ProxyURL overrides HTTPS_PROXY environment variable. It may contain the credential of the proxy.
+	ProxyURL string
+	// CABundleFile is a PEM file of additional root CAs, typically mounted from a ConfigMap.
+	CABundleFile string
+	// ClientCertFile and ClientKeyFile are the key pair for mTLS, typically mounted from a Secret.
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// newTransport returns nil if all options are the defaults so that the clients keep their default transports.
+func (o *TransportOptions) newTransport() (*tokensource.Transport, error) {
+	if *o == (TransportOptions{}) {
+		return nil, nil
+	}
+	config := &tokensource.TransportConfig{
+		CABundleFile:   o.CABundleFile,
+		ClientCertFile: o.ClientCertFile,
+		ClientKeyFile:  o.ClientKeyFile,
+	}
+	if o.ProxyURL != "" {
+		u, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		config.ProxyURL = u
+	}
+	return tokensource.NewTransport(config)
 }
 
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts/token,verbs=create
-//+kubebuilder:rbac:groups=core,resources=secrets,verbs=create;patch;update
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;create;patch;update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=example.apstn.dev,resources=imagepullsecrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=example.apstn.dev,resources=imagepullsecrets/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=example.apstn.dev,resources=imagepullsecrets/finalizers,verbs=update
@@ -67,66 +166,385 @@ type ImagePullSecretReconciler struct {
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
 func (r *ImagePullSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	l := log.FromContext(ctx)
+	defer r.warmUp.observe(req.NamespacedName)
+
+	if !r.inScope(req.Namespace) {
+		l.Info("refuse ImagePullSecret outside the watched namespaces")
+		return ctrl.Result{}, nil
+	}
+
+	if !r.ownsShard(req.Namespace) {
+		l.V(1).Info("skip ImagePullSecret in a shard held by another replica")
+		return ctrl.Result{}, nil
+	}
 
 	// your logic here
 	var imagePullSecret examplev1alpha1.ImagePullSecret
 	if err := r.Get(ctx, req.NamespacedName, &imagePullSecret); err != nil {
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+		if errors.IsNotFound(err) {
+			credentialExpiryTimestamp.DeleteLabelValues(req.Namespace, req.Name)
+			credentialRefreshFailing.DeleteLabelValues(req.Namespace, req.Name)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
 	reqb, _ := json.Marshal(req)
 	resb, _ := json.Marshal(imagePullSecret)
 	l.Info("Reconcile:", "reqb", string(reqb), "resource", string(resb))
 
+	if parked(&imagePullSecret) {
+		l.Info("skip parked ImagePullSecret")
+		return ctrl.Result{}, nil
+	}
+
+	finished, err := r.finishHandover(ctx, &imagePullSecret, time.Now())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if finished {
+		l.Info("finish handover of the previous credential")
+		if err := r.Status().Update(ctx, &imagePullSecret); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	plan, err := planRefresh(&imagePullSecret, time.Now(), r.refreshMargin())
+	if err != nil {
+		return r.handleError(ctx, &imagePullSecret, err)
+	}
+	if !plan.due {
+		drift, err := r.secretDrift(ctx, &imagePullSecret)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if drift != "" {
+			plan = plan.repair(drift)
+		}
+	}
+	settings := r.Settings()
+	plan = r.jitter.apply(req.NamespacedName, imagePullSecret.Status.ExpiresAt.Time, plan, time.Now(), settings.startupRefreshJitter())
+	if !plan.due && plan.rewrite {
+		rewritten, err := r.rewrite(ctx, &imagePullSecret)
+		if err != nil {
+			return r.handleError(ctx, &imagePullSecret, err)
+		}
+		if rewritten {
+			l.Info("apply spec.secretTemplate and spec.outputs without minting")
+		} else {
+			plan.due, plan.reason = true, "the Secret has no credential to rewrite"
+		}
+	}
+	if !plan.due {
+		l.Info("skip refresh until it is due", "next", plan.next, "reason", plan.reason)
+		// Restore the metric lost by a restart.
+		credentialExpiryTimestamp.WithLabelValues(req.Namespace, req.Name).Set(float64(imagePullSecret.Status.ExpiresAt.Unix()))
+		return ctrl.Result{RequeueAfter: requeueAfter(wakeAt(&imagePullSecret, plan))}, nil
+	}
+	l.Info("refresh", "reason", plan.reason)
+
 	if err := r.do(ctx, &imagePullSecret); err != nil {
 		l.Error(err, "r.do() failed")
-		return ctrl.Result{RequeueAfter: 30 * time.Second}, err
+		return r.handleError(ctx, &imagePullSecret, err)
+	}
+
+	plan, err = planRefresh(&imagePullSecret, time.Now(), r.refreshMargin())
+	if err != nil {
+		return r.handleError(ctx, &imagePullSecret, err)
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter(wakeAt(&imagePullSecret, plan))}, nil
+}
+
+// wakeAt returns when res should be reconciled next, i.e. the next refresh or the end of the handover.
+func wakeAt(res *examplev1alpha1.ImagePullSecret, plan refreshPlan) time.Time {
+	if d := res.Status.HandoverDeadline; d != nil && d.Time.Before(plan.next) {
+		return d.Time
+	}
+	return plan.next
+}
+
+// ownsShard reports whether the namespace is reconciled by this replica.
+func (r *ImagePullSecretReconciler) ownsShard(namespace string) bool {
+	return r.shards == nil || r.shards.owns(namespace)
+}
+
+// enqueueShard reconciles the ImagePullSecrets in the shard which is newly acquired,
+// because their events were dropped while another replica held it.
+func (r *ImagePullSecretReconciler) enqueueShard(shard int) {
+	go func() {
+		var list examplev1alpha1.ImagePullSecretList
+		if err := r.List(context.Background(), &list); err != nil {
+			shardLog.Error(err, "unable to list ImagePullSecrets of the shard", "shard", shard)
+			return
+		}
+		for i := range list.Items {
+			if shardOf(list.Items[i].Namespace, r.Sharding.Count) == shard {
+				r.shardEvents <- event.GenericEvent{Object: &list.Items[i]}
+			}
+		}
+	}()
+}
+
+// inScope reports whether the namespace is watched by the controller.
+func (r *ImagePullSecretReconciler) inScope(namespace string) bool {
+	if len(r.WatchNamespaces) == 0 {
+		return true
+	}
+	for _, ns := range r.WatchNamespaces {
+		if ns == namespace {
+			return true
+		}
 	}
+	return false
+}
 
-	return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+// requeueAfter returns the duration until next, at least one second so that a past time doesn't spin.
+func requeueAfter(next time.Time) time.Duration {
+	if d := time.Until(next); d > time.Second {
+		return d
+	}
+	return time.Second
 }
 
-func (r *ImagePullSecretReconciler) tokenSource(ctx context.Context, res *examplev1alpha1.ImagePullSecret) (oauth2.TokenSource, error) {
-	gsaEmail := res.Spec.GsaEmail
-	serviceAccountName := res.Spec.ServiceAccountName
-	serviceAccountNamespace := res.Namespace
-	workloadIdentityPoolProvider := fmt.Sprintf("//iam.googleapis.com/%s", res.Spec.WorkloadIdentityPoolProvider)
+// parked reports whether res failed permanently. Permanent failures are not retried until the spec is changed.
+func parked(res *examplev1alpha1.ImagePullSecret) bool {
+	cond := meta.FindStatusCondition(res.Status.Conditions, examplev1alpha1.ConditionReady)
+	return cond != nil && cond.Reason == reasonPermanentFailure && cond.ObservedGeneration == res.Generation
+}
 
-	kts, err := tokensource.KubernetesTokenRequestTokenSource(ctx, r.ClientSet,
-		&tokensource.KubernetsTokenRequestTokenConfig{
-			ServiceAccountNamespace: serviceAccountNamespace,
-			ServiceAccountName:      serviceAccountName,
-			Audiences:               []string{workloadIdentityPoolProvider},
+// handleError records the failure in the Ready condition and decides how to retry by the class of err.
+// Transient errors are returned to the controller so that its rate limiter backs off exponentially,
+// unless ClassifyError suggests a delay.
+func (r *ImagePullSecretReconciler) handleError(ctx context.Context, res *examplev1alpha1.ImagePullSecret, err error) (ctrl.Result, error) {
+	var violation *policyViolationError
+	if stderrors.As(err, &violation) {
+		return r.handleDenied(ctx, res, examplev1alpha1.ConditionPolicyCompliant, reasonPolicyViolation, err, 0)
+	}
+	var unauthorized *requesterUnauthorizedError
+	if stderrors.As(err, &unauthorized) {
+		return r.handleDenied(ctx, res, examplev1alpha1.ConditionRequesterAuthorized, unauthorized.reason, err, requesterRecheckInterval)
+	}
+	var throttled *throttledError
+	if stderrors.As(err, &throttled) {
+		return r.handleThrottled(ctx, res, throttled)
+	}
+
+	class, retryAfter := tokensource.ClassifyError(err)
+
+	var reason string
+	switch class {
+	case tokensource.ErrorClassPermanent:
+		reason = reasonPermanentFailure
+	case tokensource.ErrorClassQuota:
+		reason = reasonQuotaExceeded
+	default:
+		reason = reasonTransientFailure
+	}
+	meta.SetStatusCondition(&res.Status.Conditions, metav1.Condition{
+		Type:               examplev1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            err.Error(),
+		ObservedGeneration: res.Generation,
+	})
+	r.reportDegraded(res, err)
+	if statusErr := r.Status().Update(ctx, res); statusErr != nil {
+		return ctrl.Result{}, statusErr
+	}
+
+	switch {
+	case class == tokensource.ErrorClassPermanent:
+		return ctrl.Result{}, nil
+	case retryAfter > 0:
+		return ctrl.Result{RequeueAfter: retryAfter}, nil
+	default:
+		return ctrl.Result{}, err
+	}
+}
+
+// reportDegraded reports the remaining lifetime of the last good credential after refreshing failed.
+// The Secret is never touched by a failed refresh, so it still holds the credential which expires at status.expiresAt.
+func (r *ImagePullSecretReconciler) reportDegraded(res *examplev1alpha1.ImagePullSecret, err error) {
+	credentialRefreshFailing.WithLabelValues(res.Namespace, res.Name).Set(1)
+	if res.Status.ExpiresAt.IsZero() {
+		// No credential has been minted yet, so nothing is degraded but not ready.
+		return
+	}
+	credentialExpiryTimestamp.WithLabelValues(res.Namespace, res.Name).Set(float64(res.Status.ExpiresAt.Unix()))
+
+	remaining := time.Until(res.Status.ExpiresAt.Time)
+	cond := metav1.Condition{
+		Type:               examplev1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: res.Generation,
+	}
+	if remaining > 0 {
+		cond.Reason = reasonRefreshFailing
+		cond.Message = fmt.Sprintf("refresh failed, the last good credential expires at %s (in %s)",
+			res.Status.ExpiresAt.UTC().Format(time.RFC3339), remaining.Round(time.Second))
+	} else {
+		cond.Reason = reasonCredentialExpired
+		cond.Message = fmt.Sprintf("refresh failed, the last good credential expired at %s",
+			res.Status.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	meta.SetStatusCondition(&res.Status.Conditions, cond)
+
+	if remaining < expiryWarningThreshold && r.Recorder != nil {
+		r.Recorder.Eventf(res, corev1.EventTypeWarning, cond.Reason, "%s: %v", cond.Message, err)
+	}
+}
+
+// handleDenied reports that minting is denied by condType with reason.
+// It doesn't park res because the denial may be lifted without changing res,
+// so res is checked again after recheckAfter if it is not zero.
+func (r *ImagePullSecretReconciler) handleDenied(ctx context.Context, res *examplev1alpha1.ImagePullSecret, condType, reason string, err error, recheckAfter time.Duration) (ctrl.Result, error) {
+	for _, t := range []string{examplev1alpha1.ConditionReady, condType} {
+		meta.SetStatusCondition(&res.Status.Conditions, metav1.Condition{
+			Type:               t,
+			Status:             metav1.ConditionFalse,
+			Reason:             reason,
+			Message:            err.Error(),
+			ObservedGeneration: res.Generation,
 		})
-	if err != nil {
+	}
+	r.reportDegraded(res, err)
+	if r.Recorder != nil {
+		r.Recorder.Event(res, corev1.EventTypeWarning, reason, err.Error())
+	}
+	return ctrl.Result{RequeueAfter: recheckAfter}, r.Status().Update(ctx, res)
+}
+
+// validate checks the spec which can't be validated by the CRD schema.
+// Errors are permanent because they are never resolved without a spec change.
+func validate(res *examplev1alpha1.ImagePullSecret) error {
+	if lt := res.Spec.TokenLifetime; lt != nil && (lt.Duration <= 0 || lt.Duration > maxTokenLifetime) {
+		return &tokensource.PermanentError{Err: fmt.Errorf("spec.tokenLifetime must be in (0, %v]: %v", maxTokenLifetime, lt.Duration)}
+	}
+	if len(res.Spec.Delegates) > maxDelegates {
+		return &tokensource.PermanentError{Err: fmt.Errorf("spec.delegates must have at most %d items: %d", maxDelegates, len(res.Spec.Delegates))}
+	}
+	if res.Spec.CredentialConfig == nil {
+		if res.Spec.ServiceAccountName == "" && res.Spec.SubjectToken == nil {
+			return &tokensource.PermanentError{Err: fmt.Errorf("either spec.serviceAccountName, spec.subjectToken or spec.credentialConfig is required")}
+		}
+		if res.Spec.GsaEmail == "" || res.Spec.WorkloadIdentityPoolProvider == "" {
+			return &tokensource.PermanentError{Err: fmt.Errorf("spec.gsaEmail and spec.workloadIdentityPoolProvider are required without spec.credentialConfig")}
+		}
+	}
+	for i, d := range res.Spec.Delegates {
+		if d == "" || d == res.Spec.GsaEmail {
+			return &tokensource.PermanentError{Err: fmt.Errorf("spec.delegates[%d] must be an email of an intermediate service account: %q", i, d)}
+		}
+	}
+	if res.Spec.RotationSchedule != "" {
+		if _, err := parseRotationSchedule(res.Spec.RotationSchedule); err != nil {
+			return err
+		}
+	}
+	if h := res.Spec.Handover; h != nil {
+		if err := validateHandover(h); err != nil {
+			return err
+		}
+	}
+	if v := res.Spec.Verify; v != nil {
+		for i, image := range v.Images {
+			if _, err := parseImageReference(image); err != nil {
+				return &tokensource.PermanentError{Err: fmt.Errorf("spec.verify.images[%d]: %w", i, err)}
+			}
+		}
+	}
+	if e := res.Spec.Endpoints; e != nil {
+		if err := validateEndpoints("spec.endpoints", e.STS, e.IAMCredentials); err != nil {
+			return err
+		}
+	}
+	if t := res.Spec.SecretTemplate; t != nil {
+		if err := validateSecretTemplate(t); err != nil {
+			return err
+		}
+	}
+	if err := validateOutputs(res); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ImagePullSecretReconciler) tokenSource(ctx context.Context, res *examplev1alpha1.ImagePullSecret, ex *exchange) (oauth2.TokenSource, error) {
+	if err := r.reserveTokenExchange(ex); err != nil {
 		return nil, err
 	}
 
-	stsTs, err := tokensource.OidcStsTokenSource(ctx, workloadIdentityPoolProvider, kts)
+	var kts oauth2.TokenSource
+	var err error
+	if ex.externalAccount != nil && res.Spec.ServiceAccountName == "" && res.Spec.SubjectToken == nil {
+		kts, err = r.credentialSourceTokenSource(ctx, ex.externalAccount)
+	} else {
+		kts, err = r.subjectTokenSource(ctx, res, ex.audience)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-
-	scopes := []string{cloudPlatformScope, userInfoEmailScope}
-	impTs, err := tokensource.ImpersonateTokenSource(ctx, gsaEmail, stsTs, scopes...)
+	stsTs, err := tokensource.OidcStsTokenSource(ctx, kts, &tokensource.OidcStsTokenConfig{
+		Audience:         ex.audience,
+		SubjectTokenType: ex.subjectTokenType,
+		Endpoint:         ex.stsEndpoint,
+		Transport:        r.transport,
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	scopes := res.Spec.Scopes
+	if len(scopes) == 0 {
+		settings := r.Settings()
+		scopes = settings.defaultScopes()
+	}
+	var lifetime time.Duration
+	if res.Spec.TokenLifetime != nil {
+		lifetime = res.Spec.TokenLifetime.Duration
+	}
+	impTs, err := tokensource.ImpersonateTokenSource(ctx, stsTs, &tokensource.ImpersonateTokenConfig{
+		Target:    ex.gsaEmail,
+		Scopes:    scopes,
+		Lifetime:  lifetime,
+		Delegates: res.Spec.Delegates,
+		Endpoint:  ex.iamCredentialsEndpoint,
+		Transport: r.transport,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// Wrap to avoid to issue token repeatedly for tokenInfo call
 	return oauth2.ReuseTokenSource(nil, impTs), nil
 }
 
+// do mints a new credential and writes it to the Secret.
+// The Secret is written only after the whole token exchange succeeded, so a failed refresh never touches it.
 func (r *ImagePullSecretReconciler) do(ctx context.Context, res *examplev1alpha1.ImagePullSecret) error {
-	ts, err := r.tokenSource(ctx, res)
+	if !r.inScope(res.Namespace) {
+		return &tokensource.PermanentError{Err: fmt.Errorf("namespace %s is not watched by the controller", res.Namespace)}
+	}
+	if err := validate(res); err != nil {
+		return err
+	}
+	if err := r.authorizeRequester(ctx, res); err != nil {
+		return err
+	}
+	ex, err := r.resolveExchange(ctx, res)
+	if err != nil {
+		return err
+	}
+	if err := r.checkPolicy(ctx, res, ex); err != nil {
+		return err
+	}
+	ts, err := r.tokenSource(ctx, res, ex)
 	if err != nil {
 		return err
 	}
 
 	// Print token information
-	tokeninfoResp, err := tokenInfo(ctx, ts)
+	tokeninfoResp, err := tokenInfo(ctx, ts, r.transport)
 	if err != nil {
 		return err
 	}
@@ -137,44 +555,141 @@ func (r *ImagePullSecretReconciler) do(ctx context.Context, res *examplev1alpha1
 		return err
 	}
 
-	err = r.upsertDockerConfigSecret(ctx, res, t)
+	now := time.Now()
+	err = r.writeCredential(ctx, res, t, now)
 	if err != nil {
 		return err
 	}
+	if hash, ok := r.written.lookup(types.NamespacedName{Namespace: res.Namespace, Name: currentSecretName(res)}); ok {
+		res.Status.SecretHash = hash
+	}
+	if err := r.writeOutputs(ctx, res, t.AccessToken); err != nil {
+		return err
+	}
+	r.verifyRegistryAccess(ctx, res, t.AccessToken)
 
 	// Update status only if succeed
 	res.Status.ExpiresAt = metav1.NewTime(t.Expiry)
+	recordRefresh(res, now)
+	res.Status.MintedSpecHash = mintedSpecHash(&res.Spec)
+	res.Status.DelegationChain = append(append([]string(nil), res.Spec.Delegates...), ex.gsaEmail)
+	meta.SetStatusCondition(&res.Status.Conditions, metav1.Condition{
+		Type:               examplev1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonMinted,
+		Message:            "credential is minted",
+		ObservedGeneration: res.Generation,
+	})
+	if r.requesterAuthorizationEnabled(res) {
+		meta.SetStatusCondition(&res.Status.Conditions, metav1.Condition{
+			Type:               examplev1alpha1.ConditionRequesterAuthorized,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonRequesterAuthorized,
+			Message:            "the requester may use spec.serviceAccountName and spec.subjectToken by itself",
+			ObservedGeneration: res.Generation,
+		})
+	}
+	if r.policiesEnforced() {
+		meta.SetStatusCondition(&res.Status.Conditions, metav1.Condition{
+			Type:               examplev1alpha1.ConditionPolicyCompliant,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonPolicyAllowed,
+			Message:            "allowed by ImagePullSecretPolicies",
+			ObservedGeneration: res.Generation,
+		})
+	} else {
+		meta.SetStatusCondition(&res.Status.Conditions, metav1.Condition{
+			Type:               examplev1alpha1.ConditionPolicyCompliant,
+			Status:             metav1.ConditionUnknown,
+			Reason:             reasonPolicyNotEnforced,
+			Message:            "ImagePullSecretPolicies are not enforced by the controller watching only some namespaces",
+			ObservedGeneration: res.Generation,
+		})
+	}
+	meta.SetStatusCondition(&res.Status.Conditions, metav1.Condition{
+		Type:               examplev1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonRefreshSucceeded,
+		Message:            "the credential is refreshed",
+		ObservedGeneration: res.Generation,
+	})
+	credentialExpiryTimestamp.WithLabelValues(res.Namespace, res.Name).Set(float64(t.Expiry.Unix()))
+	credentialRefreshFailing.WithLabelValues(res.Namespace, res.Name).Set(0)
 	return r.Status().Update(ctx, res)
 }
 
-func (r *ImagePullSecretReconciler) upsertDockerConfigSecret(ctx context.Context, res *examplev1alpha1.ImagePullSecret, token *oauth2.Token) error {
-	gsaEmail := res.Spec.GsaEmail
-	secretNamespace := res.Namespace
-	secretName := res.Spec.SecretName
-
-	b, err := generateDockerConfigJson(gsaEmail, token.AccessToken)
-	if err != nil {
-		return err
-	}
+// registries returns hostnames of the registries which the Secret of res is valid for.
+func (r *ImagePullSecretReconciler) registries(res *examplev1alpha1.ImagePullSecret) []string {
+	settings := r.Settings()
+	registries := settings.defaultRegistries()
+	registries = append(registries, settings.ExtraRegistries...)
+	registries = append(registries, res.Spec.ExtraRegistries...)
+	return registries
+}
 
+// dockerConfigSecret returns the Secret of the name in the namespace of res holding the .dockerconfigjson
+// and the keys of spec.secretTemplate.
+func (r *ImagePullSecretReconciler) dockerConfigSecret(res *examplev1alpha1.ImagePullSecret, name string, dockerConfigJson []byte, token *oauth2.Token) *corev1.Secret {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: secretNamespace,
-			Name:      secretName,
+			Namespace: res.Namespace,
+			Name:      name,
 		},
-		Data: map[string][]byte{".dockerconfigjson": b},
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: dockerConfigJson},
 		Type: corev1.SecretTypeDockerConfigJson,
 	}
-	err = r.Create(ctx, secret)
+	applySecretTemplate(secret, res, token)
+	return secret
+}
+
+func (r *ImagePullSecretReconciler) upsertSecret(ctx context.Context, secret *corev1.Secret) error {
+	err := r.Create(ctx, secret)
 	if errors.IsAlreadyExists(err) {
 		err = r.Update(ctx, secret)
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	r.written.record(secret)
+	return nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ImagePullSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&examplev1alpha1.ImagePullSecret{}).
-		Complete(r)
+	transport, err := r.TransportOptions.newTransport()
+	if err != nil {
+		return err
+	}
+	r.transport = transport
+	r.health.cache = mgr.GetCache()
+	r.health.elected = mgr.Elected()
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		// Ignore status updates so that recording conditions doesn't bypass the backoff.
+		// The requester annotation may be recorded without changing the spec.
+		For(&examplev1alpha1.ImagePullSecret{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles})
+	if b, err = r.watchSecrets(mgr, b); err != nil {
+		return err
+	}
+	if err := r.startWarmUp(mgr); err != nil {
+		return err
+	}
+	if r.Sharding.enabled() {
+		if err := r.Sharding.validate(); err != nil {
+			return err
+		}
+		r.shardEvents = make(chan event.GenericEvent)
+		r.shards = newShardManager(r.Sharding, r.ClientSet, r.enqueueShard)
+		if err := mgr.Add(r.shards); err != nil {
+			return err
+		}
+		b = b.Watches(&source.Channel{Source: r.shardEvents}, &handler.EnqueueRequestForObject{})
+	}
+	if r.policiesEnforced() {
+		b = b.Watches(&source.Kind{Type: &examplev1alpha1.ImagePullSecretPolicy{}}, handler.EnqueueRequestsFromMapFunc(r.imagePullSecretsForPolicy))
+	} else {
+		policyLog.Info("ImagePullSecretPolicies are not enforced because the controller watches only some namespaces", "namespaces", r.WatchNamespaces)
+	}
+	return b.Complete(r)
 }
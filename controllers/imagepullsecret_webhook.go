@@ -0,0 +1,135 @@
+/*
+Copyright 2021 apstndb.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+var imagePullSecretWebhookLog = logf.Log.WithName("imagepullsecret-webhook")
+
+//+kubebuilder:webhook:path=/mutate-example-apstn-dev-v1alpha1-imagepullsecret,mutating=true,failurePolicy=fail,sideEffects=None,groups=example.apstn.dev,resources=imagepullsecrets,verbs=create;update,versions=v1alpha1,name=mimagepullsecret.example.apstn.dev,admissionReviewVersions={v1,v1beta1}
+
+// ImagePullSecretRequesterRecorder records the requesting user in RequesterAnnotation.
+// The requester is updated when the spec is changed or it is not recorded yet, and preserved otherwise,
+// so users can't forge it.
+type ImagePullSecretRequesterRecorder struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &ImagePullSecretRequesterRecorder{}
+
+func (m *ImagePullSecretRequesterRecorder) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var res examplev1alpha1.ImagePullSecret
+	if err := m.decoder.Decode(req, &res); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	requester, err := json.Marshal(req.UserInfo)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	value := string(requester)
+	if req.Operation == admissionv1.Update {
+		var old examplev1alpha1.ImagePullSecret
+		if err := m.decoder.DecodeRaw(req.OldObject, &old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if oldValue, ok := old.Annotations[RequesterAnnotation]; ok && equality.Semantic.DeepEqual(old.Spec, res.Spec) {
+			value = oldValue
+		}
+	}
+	if res.Annotations[RequesterAnnotation] == value {
+		return admission.Allowed("the requester is up to date")
+	}
+
+	if res.Annotations == nil {
+		res.Annotations = make(map[string]string)
+	}
+	res.Annotations[RequesterAnnotation] = value
+	marshaled, err := json.Marshal(&res)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (m *ImagePullSecretRequesterRecorder) InjectDecoder(d *admission.Decoder) error {
+	m.decoder = d
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-example-apstn-dev-v1alpha1-imagepullsecret,mutating=false,failurePolicy=fail,sideEffects=None,groups=example.apstn.dev,resources=imagepullsecrets,verbs=create;update,versions=v1alpha1,name=vimagepullsecret.example.apstn.dev,admissionReviewVersions={v1,v1beta1}
+
+// ImagePullSecretValidator denies ImagePullSecrets which violate ImagePullSecretPolicies.
+// The reconciler enforces the policies again, because the credential configuration and the policies may change after admission.
+type ImagePullSecretValidator struct {
+	Reconciler *ImagePullSecretReconciler
+
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &ImagePullSecretValidator{}
+
+func (v *ImagePullSecretValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var res examplev1alpha1.ImagePullSecret
+	if err := v.decoder.Decode(req, &res); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !v.Reconciler.inScope(res.Namespace) {
+		return admission.Allowed("the namespace is not watched by the controller")
+	}
+
+	var ex *exchange
+	if res.Spec.CredentialConfig != nil {
+		// The ConfigMap may be created later, so only the spec is checked in that case.
+		resolved, err := v.Reconciler.resolveExchange(ctx, &res)
+		if err != nil {
+			imagePullSecretWebhookLog.Info("check the spec only because the credential configuration is not resolved", "namespace", res.Namespace, "name", res.Name, "error", err.Error())
+		} else {
+			ex = resolved
+		}
+	}
+
+	err := v.Reconciler.checkPolicy(ctx, &res, ex)
+	var violation *policyViolationError
+	switch {
+	case errors.As(err, &violation):
+		return admission.Denied(violation.Error())
+	case err != nil:
+		return admission.Errored(http.StatusInternalServerError, err)
+	default:
+		return admission.Allowed("")
+	}
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *ImagePullSecretValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// credentialExpiryTimestamp lets alerting compute the remaining lifetime without waiting for a reconciliation.
+	credentialExpiryTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "image_pull_secret_credential_expiry_timestamp_seconds",
+		Help: "Expiry time of the last good credential written to the Secret, in seconds since epoch.",
+	}, []string{"namespace", "name"})
+
+	credentialRefreshFailing = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "image_pull_secret_credential_refresh_failing",
+		Help: "1 if the last refresh of the credential failed, 0 otherwise.",
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(credentialExpiryTimestamp, credentialRefreshFailing)
+}
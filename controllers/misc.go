@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"golang.org/x/oauth2"
 	goauth2 "google.golang.org/api/oauth2/v1"
-	"google.golang.org/api/option"
+
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
 )
 
 // gcloud artifacts locations list --format='value(format("\"{0}-docker.pkg.dev\",", name))'
@@ -45,27 +47,56 @@ var artifactRegistries = []string{
 // https://cloud.google.com/container-registry/docs/overview?hl=en
 var gcrRegistries = []string{"gcr.io", "asia.gcr.io", "eu.gcr.io", "us.gcr.io"}
 
-func generateDockerConfigJson(gsaEmail string, accessToken string) ([]byte, error) {
+// defaultRegistries returns hostnames of all public endpoints of Container Registry and Artifact Registry.
+func defaultRegistries() []string {
 	var registries []string
 	registries = append(registries, gcrRegistries...)
 	registries = append(registries, artifactRegistries...)
+	return registries
+}
 
-	type dockerCfgAuth struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Email    string `json:"email"`
+// imageRegistryHost returns the registry hostname of the image reference, following the rule of Docker.
+// e.g. "us-docker.pkg.dev/project/repo/image:tag" -> "us-docker.pkg.dev", "nginx" -> "docker.io"
+func imageRegistryHost(image string) string {
+	i := strings.IndexRune(image, '/')
+	if i < 0 {
+		return "docker.io"
 	}
-	type dockerCfg struct {
-		Auths map[string]dockerCfgAuth `json:"auths"`
+	host := image[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "docker.io"
+	}
+	return host
+}
+
+// dockerConfigUsername is the username of the access token authentication of Container Registry and Artifact Registry.
+const dockerConfigUsername = "oauth2accesstoken"
+
+type dockerCfgAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+type dockerCfg struct {
+	Auths map[string]dockerCfgAuth `json:"auths"`
+}
+
+// addAuths adds the access token for the registries, with the keys prefixed by prefix.
+func (cfg *dockerCfg) addAuths(prefix, gsaEmail, accessToken string, registries []string) {
+	if cfg.Auths == nil {
+		cfg.Auths = make(map[string]dockerCfgAuth)
 	}
-	cfg := dockerCfg{Auths: make(map[string]dockerCfgAuth)}
 	for _, reg := range registries {
-		cfg.Auths[reg] = dockerCfgAuth{
-			Username: "oauth2accesstoken",
+		cfg.Auths[prefix+reg] = dockerCfgAuth{
+			Username: dockerConfigUsername,
 			Password: accessToken,
 			Email:    gsaEmail,
 		}
 	}
+}
+
+func (cfg *dockerCfg) marshal() ([]byte, error) {
 	j, err := json.Marshal(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal: %w", err)
@@ -73,8 +104,16 @@ func generateDockerConfigJson(gsaEmail string, accessToken string) ([]byte, erro
 	return j, nil
 }
 
-func tokenInfo(ctx context.Context, ts oauth2.TokenSource) (*goauth2.Tokeninfo, error) {
-	goauth2Svc, err := goauth2.NewService(ctx, option.WithTokenSource(ts))
+func parseDockerConfigJson(b []byte) (*dockerCfg, error) {
+	var cfg dockerCfg
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return &cfg, nil
+}
+
+func tokenInfo(ctx context.Context, ts oauth2.TokenSource, transport *tokensource.Transport) (*goauth2.Tokeninfo, error) {
+	goauth2Svc, err := goauth2.NewService(ctx, transport.HTTPClientOptions(ts)...)
 	if err != nil {
 		return nil, fmt.Errorf("oauth2.TokenInfo: %w", err)
 	}
@@ -0,0 +1,22 @@
+package controllers
+
+import "testing"
+
+func TestImageRegistryHost(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"nginx", "docker.io"},
+		{"library/nginx:latest", "docker.io"},
+		{"gcr.io/project/image", "gcr.io"},
+		{"us-central1-docker.pkg.dev/project/repo/image@sha256:0123", "us-central1-docker.pkg.dev"},
+		{"localhost/image", "localhost"},
+		{"registry.example.com:5000/image:tag", "registry.example.com:5000"},
+	}
+	for _, tt := range tests {
+		if got := imageRegistryHost(tt.image); got != tt.want {
+			t.Errorf("imageRegistryHost(%q): want %q, got %q", tt.image, tt.want, got)
+		}
+	}
+}
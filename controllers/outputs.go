@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
+)
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;create;update;delete
+
+// outputTarget returns the target with the default kind.
+func outputTarget(o *examplev1alpha1.Output) examplev1alpha1.OutputTarget {
+	t := o.Target
+	if t.Kind == "" {
+		t.Kind = examplev1alpha1.OutputSecret
+	}
+	return t
+}
+
+func outputKey(o *examplev1alpha1.Output) string {
+	if o.Key != "" {
+		return o.Key
+	}
+	return formatters[o.Format].defaultKey()
+}
+
+func validateOutputs(res *examplev1alpha1.ImagePullSecret) error {
+	type targetKey struct {
+		target examplev1alpha1.OutputTarget
+		key    string
+	}
+	seen := make(map[targetKey]bool)
+	for i := range res.Spec.Outputs {
+		o := &res.Spec.Outputs[i]
+		if _, ok := formatters[o.Format]; !ok {
+			return &tokensource.PermanentError{Err: fmt.Errorf("spec.outputs[%d].format: unknown format: %q", i, o.Format)}
+		}
+		target := outputTarget(o)
+		if msgs := validation.IsDNS1123Subdomain(target.Name); len(msgs) != 0 {
+			return &tokensource.PermanentError{Err: fmt.Errorf("spec.outputs[%d].target.name: %q: %s", i, target.Name, strings.Join(msgs, ", "))}
+		}
+		if target.Kind == examplev1alpha1.OutputSecret && target.Name == res.Spec.SecretName {
+			return &tokensource.PermanentError{Err: fmt.Errorf("spec.outputs[%d].target.name: must not be spec.secretName: %q", i, target.Name)}
+		}
+		key := outputKey(o)
+		if msgs := validation.IsConfigMapKey(key); len(msgs) != 0 {
+			return &tokensource.PermanentError{Err: fmt.Errorf("spec.outputs[%d].key: %q: %s", i, key, strings.Join(msgs, ", "))}
+		}
+		k := targetKey{target, key}
+		if seen[k] {
+			return &tokensource.PermanentError{Err: fmt.Errorf("spec.outputs[%d]: %s %s has the key %q already", i, target.Kind, target.Name, key)}
+		}
+		seen[k] = true
+	}
+	return nil
+}
+
+// renderOutputs renders spec.outputs and groups them by the target.
+func renderOutputs(res *examplev1alpha1.ImagePullSecret, accessToken string, registries []string) (map[examplev1alpha1.OutputTarget]map[string][]byte, error) {
+	rendered := make(map[examplev1alpha1.OutputTarget]map[string][]byte)
+	for i := range res.Spec.Outputs {
+		o := &res.Spec.Outputs[i]
+		b, err := formatters[o.Format].format(res.Spec.GsaEmail, accessToken, registries)
+		if err != nil {
+			return nil, fmt.Errorf("spec.outputs[%d]: %w", i, err)
+		}
+		target := outputTarget(o)
+		if rendered[target] == nil {
+			rendered[target] = make(map[string][]byte)
+		}
+		rendered[target][outputKey(o)] = b
+	}
+	return rendered, nil
+}
+
+// writeOutputs writes spec.outputs with the access token, and deletes the targets removed from spec.outputs.
+func (r *ImagePullSecretReconciler) writeOutputs(ctx context.Context, res *examplev1alpha1.ImagePullSecret, accessToken string) error {
+	rendered, err := renderOutputs(res, accessToken, r.registries(res))
+	if err != nil {
+		return err
+	}
+	targets := make([]examplev1alpha1.OutputTarget, 0, len(rendered))
+	for target, data := range rendered {
+		if err := r.upsertOutput(ctx, res, target, data); err != nil {
+			return fmt.Errorf("%s %s: %w", target.Kind, target.Name, err)
+		}
+		targets = append(targets, target)
+	}
+	for _, target := range res.Status.OutputTargets {
+		if _, ok := rendered[target]; ok {
+			continue
+		}
+		if err := r.deleteOutput(ctx, res, target); err != nil {
+			return fmt.Errorf("%s %s: %w", target.Kind, target.Name, err)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Kind != targets[j].Kind {
+			return targets[i].Kind < targets[j].Kind
+		}
+		return targets[i].Name < targets[j].Name
+	})
+	if len(targets) == 0 {
+		targets = nil
+	}
+	res.Status.OutputTargets = targets
+	return nil
+}
+
+// upsertOutput replaces the data of the target. Existing objects which are not controlled by res are never overwritten.
+// Use the clientset not to cache all Secrets and ConfigMaps in the cluster.
+func (r *ImagePullSecretReconciler) upsertOutput(ctx context.Context, res *examplev1alpha1.ImagePullSecret, target examplev1alpha1.OutputTarget, data map[string][]byte) error {
+	switch target.Kind {
+	case examplev1alpha1.OutputSecret:
+		secrets := r.ClientSet.CoreV1().Secrets(res.Namespace)
+		secret, err := secrets.Get(ctx, target.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: res.Namespace, Name: target.Name}, Type: corev1.SecretTypeOpaque}
+			if err := r.prepareOutput(&secret.ObjectMeta, res); err != nil {
+				return err
+			}
+			secret.Data = data
+			_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+		} else if err == nil {
+			if !metav1.IsControlledBy(secret, res) {
+				return &tokensource.PermanentError{Err: fmt.Errorf("the existing Secret is not owned by the ImagePullSecret")}
+			}
+			if err := r.prepareOutput(&secret.ObjectMeta, res); err != nil {
+				return err
+			}
+			secret.Data = data
+			_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		}
+		return err
+	case examplev1alpha1.OutputConfigMap:
+		strData := make(map[string]string, len(data))
+		for k, v := range data {
+			strData[k] = string(v)
+		}
+		configMaps := r.ClientSet.CoreV1().ConfigMaps(res.Namespace)
+		cm, err := configMaps.Get(ctx, target.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: res.Namespace, Name: target.Name}}
+			if err := r.prepareOutput(&cm.ObjectMeta, res); err != nil {
+				return err
+			}
+			cm.Data = strData
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if !metav1.IsControlledBy(cm, res) {
+			return &tokensource.PermanentError{Err: fmt.Errorf("the existing ConfigMap is not owned by the ImagePullSecret")}
+		}
+		if err := r.prepareOutput(&cm.ObjectMeta, res); err != nil {
+			return err
+		}
+		cm.Data = strData
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	default:
+		return &tokensource.PermanentError{Err: fmt.Errorf("unknown kind: %q", target.Kind)}
+	}
+}
+
+// prepareOutput applies the metadata of spec.secretTemplate, and makes res the controller so that the target is garbage-collected with it.
+func (r *ImagePullSecretReconciler) prepareOutput(meta *metav1.ObjectMeta, res *examplev1alpha1.ImagePullSecret) error {
+	applyTemplateMetadata(meta, res)
+	obj := &metav1.PartialObjectMetadata{ObjectMeta: *meta}
+	if err := controllerutil.SetControllerReference(res, obj, r.Scheme); err != nil {
+		return err
+	}
+	meta.OwnerReferences = obj.OwnerReferences
+	return nil
+}
+
+// deleteOutput deletes the target if it is controlled by res.
+func (r *ImagePullSecretReconciler) deleteOutput(ctx context.Context, res *examplev1alpha1.ImagePullSecret, target examplev1alpha1.OutputTarget) error {
+	var obj metav1.Object
+	var err error
+	switch target.Kind {
+	case examplev1alpha1.OutputSecret:
+		obj, err = r.ClientSet.CoreV1().Secrets(res.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+	case examplev1alpha1.OutputConfigMap:
+		obj, err = r.ClientSet.CoreV1().ConfigMaps(res.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+	default:
+		return nil
+	}
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(obj, res) {
+		return nil
+	}
+	opts := metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: uidOf(obj)}}
+	if target.Kind == examplev1alpha1.OutputSecret {
+		err = r.ClientSet.CoreV1().Secrets(res.Namespace).Delete(ctx, target.Name, opts)
+	} else {
+		err = r.ClientSet.CoreV1().ConfigMaps(res.Namespace).Delete(ctx, target.Name, opts)
+	}
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func uidOf(obj metav1.Object) *types.UID {
+	uid := obj.GetUID()
+	return &uid
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 apstndb.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+const (
+	// InjectLabel on a Namespace enables or disables the injection of imagePullSecrets into its Pods.
+	InjectLabel = "image-pull-secret.apstn.dev/inject"
+
+	injectEnabled  = "enabled"
+	injectDisabled = "disabled"
+
+	// webhookTimeout bounds the whole request including synchronous minting so that the webhook responds
+	// before the API server times out by timeoutSeconds of the webhook, 10s.
+	// Otherwise the Pod is admitted without any injection by failurePolicy=ignore.
+	webhookTimeout = 8 * time.Second
+)
+
+var podWebhookLog = logf.Log.WithName("pod-webhook")
+
+//+kubebuilder:webhook:path=/mutate-v1-pod,mutating=true,failurePolicy=ignore,sideEffects=NoneOnDryRun,groups="",resources=pods,verbs=create,versions=v1,name=mpod.image-pull-secret.apstn.dev,admissionReviewVersions={v1,v1beta1}
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// PodImagePullSecretInjector adds the Secrets managed by ImagePullSecrets to spec.imagePullSecrets of Pods
+// whose images are hosted on the registries of the Secrets.
+type PodImagePullSecretInjector struct {
+	Client     client.Client
+	Reconciler *ImagePullSecretReconciler
+
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &PodImagePullSecretInjector{}
+
+func (h *PodImagePullSecretInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	var pod corev1.Pod
+	if err := h.decoder.Decode(req, &pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if !h.Reconciler.inScope(req.Namespace) {
+		return admission.Allowed("the namespace is not watched by the controller")
+	}
+
+	enabled, err := h.injectionEnabled(ctx, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !enabled {
+		return admission.Allowed("injection is disabled in the namespace")
+	}
+
+	var list examplev1alpha1.ImagePullSecretList
+	if err := h.Client.List(ctx, &list, client.InNamespace(req.Namespace)); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	hosts := podImageRegistryHosts(&pod)
+	dryRun := req.DryRun != nil && *req.DryRun
+	var injected []string
+	for i := range list.Items {
+		res := &list.Items[i]
+		if !policyCompliant(res) || versionedHandover(res) || !h.managesAnyRegistry(res, hosts) || hasImagePullSecret(&pod, currentSecretName(res)) {
+			continue
+		}
+		if !dryRun {
+			h.ensureSecret(ctx, res)
+		}
+		name := currentSecretName(res)
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+		injected = append(injected, name)
+	}
+	if len(injected) == 0 {
+		return admission.Allowed("no ImagePullSecret manages the registries of the images")
+	}
+
+	marshaled, err := json.Marshal(&pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	podWebhookLog.Info("inject imagePullSecrets", "namespace", req.Namespace, "pod", req.Name, "secrets", injected)
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (h *PodImagePullSecretInjector) InjectDecoder(d *admission.Decoder) error {
+	h.decoder = d
+	return nil
+}
+
+func (h *PodImagePullSecretInjector) injectionEnabled(ctx context.Context, namespace string) (bool, error) {
+	var ns corev1.Namespace
+	if err := h.Client.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+		return false, err
+	}
+	switch ns.Labels[InjectLabel] {
+	case injectEnabled:
+		return true, nil
+	case injectDisabled:
+		return false, nil
+	default:
+		return h.Reconciler.Settings().InjectByDefault, nil
+	}
+}
+
+// ensureSecret mints the Secret synchronously if it doesn't exist yet so that the first pull of the Pod succeeds.
+// All replicas serve the webhook, but only the replica which reconciles res, i.e. the leader or the holder of its shard, mints it.
+// Other replicas only inject the name and leave the Secret to that replica, so that two replicas never write the Secret
+// and the status at once, e.g. losing the previous token of Alias handover. kubelet retries pulling until the Secret is created.
+// Failures are recorded in the conditions as the controller does, and the controller retries them.
+func (h *PodImagePullSecretInjector) ensureSecret(ctx context.Context, res *examplev1alpha1.ImagePullSecret) {
+	r := h.Reconciler
+	if parked(res) || !r.elected() || !r.ownsShard(res.Namespace) {
+		return
+	}
+	_, err := r.ClientSet.CoreV1().Secrets(res.Namespace).Get(ctx, currentSecretName(res), metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		return
+	}
+
+	if err := r.do(ctx, res); err != nil {
+		podWebhookLog.Error(err, "failed to mint the Secret synchronously", "namespace", res.Namespace, "name", res.Name)
+		// The returned error only asks for a retry, which the controller does by itself.
+		_, _ = r.handleError(ctx, res, err)
+	}
+}
+
+// podImageRegistryHosts returns the registry hosts of all containers, including init containers.
+// Ephemeral containers are not scanned because they are never in a Pod CREATE request.
+// They are added by pods/ephemeralcontainers subresource later, when spec.imagePullSecrets is immutable.
+func podImageRegistryHosts(pod *corev1.Pod) map[string]bool {
+	hosts := make(map[string]bool)
+	for _, c := range pod.Spec.InitContainers {
+		hosts[imageRegistryHost(c.Image)] = true
+	}
+	for _, c := range pod.Spec.Containers {
+		hosts[imageRegistryHost(c.Image)] = true
+	}
+	return hosts
+}
+
+// versionedHandover reports whether res writes each credential to a new Secret.
+// Its Secrets are not injected because the Pod would refer to a Secret deleted after the grace period,
+// and long-lived Pods couldn't pull again.
+func versionedHandover(res *examplev1alpha1.ImagePullSecret) bool {
+	h := res.Spec.Handover
+	return h != nil && h.Mode == examplev1alpha1.HandoverVersioned
+}
+
+func (h *PodImagePullSecretInjector) managesAnyRegistry(res *examplev1alpha1.ImagePullSecret, hosts map[string]bool) bool {
+	for _, reg := range h.Reconciler.registries(res) {
+		if hosts[reg] {
+			return true
+		}
+	}
+	return false
+}
+
+func hasImagePullSecret(pod *corev1.Pod, name string) bool {
+	for _, ref := range pod.Spec.ImagePullSecrets {
+		if ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
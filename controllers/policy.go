@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+// Reasons of the PolicyCompliant condition. reasonPolicyViolation is also used by the Ready condition.
+const (
+	reasonPolicyAllowed     = "Allowed"
+	reasonPolicyViolation   = "PolicyViolation"
+	reasonPolicyNotEnforced = "NotEnforced"
+)
+
+var policyLog = ctrl.Log.WithName("policy")
+
+//+kubebuilder:rbac:groups=example.apstn.dev,resources=imagepullsecretpolicies,verbs=get;list;watch
+
+// policyViolationError is returned if no ImagePullSecretPolicy selecting the namespace allows the ImagePullSecret.
+// It is not retried until the ImagePullSecret or the policies are changed.
+type policyViolationError struct {
+	violations []string
+}
+
+func (e *policyViolationError) Error() string {
+	return "violates ImagePullSecretPolicy: " + strings.Join(e.violations, "; ")
+}
+
+// policySubject is what ImagePullSecretPolicy restricts. Empty values are not checked.
+type policySubject struct {
+	serviceAccountName string
+	// gsaEmails are the impersonated service accounts including the delegates.
+	gsaEmails  []string
+	provider   string
+	registries []string
+	oidcIssuer string
+	audience   string
+	// stsEndpoint and iamCredentialsEndpoint are set only if they override the controller defaults.
+	stsEndpoint            string
+	iamCredentialsEndpoint string
+}
+
+// newPolicySubject uses the resolved exchange if ex is not nil, the spec otherwise.
+// settings are the controller defaults of the endpoints.
+func newPolicySubject(res *examplev1alpha1.ImagePullSecret, ex *exchange, settings Settings) *policySubject {
+	gsaEmail, provider := res.Spec.GsaEmail, res.Spec.WorkloadIdentityPoolProvider
+	var stsEndpoint, iamCredentialsEndpoint string
+	if e := res.Spec.Endpoints; e != nil {
+		stsEndpoint, iamCredentialsEndpoint = e.STS, e.IAMCredentials
+	}
+	if ex != nil {
+		gsaEmail, provider = ex.gsaEmail, strings.TrimPrefix(ex.audience, "//iam.googleapis.com/")
+		stsEndpoint, iamCredentialsEndpoint = ex.stsEndpoint, ex.iamCredentialsEndpoint
+	}
+	s := &policySubject{
+		serviceAccountName: res.Spec.ServiceAccountName,
+		gsaEmails:          append(append([]string{}, res.Spec.Delegates...), gsaEmail),
+		provider:           provider,
+		registries:         res.Spec.ExtraRegistries,
+		// The defaults are what the cluster administrator configured, so they are not overrides.
+		stsEndpoint:            overriddenEndpoint(stsEndpoint, settings.StsEndpoint, defaultStsEndpoint),
+		iamCredentialsEndpoint: overriddenEndpoint(iamCredentialsEndpoint, settings.IamCredentialsEndpoint, defaultIamCredentialsEndpoint),
+	}
+	if sat := res.Spec.ServiceAccountToken; sat != nil {
+		s.audience = sat.Audience
+	}
+	if st := res.Spec.SubjectToken; st != nil && st.OIDC != nil {
+		s.oidcIssuer = st.OIDC.Issuer
+	}
+	return s
+}
+
+// overriddenEndpoint returns empty string if endpoint is one of the defaults.
+func overriddenEndpoint(endpoint string, defaults ...string) string {
+	for _, d := range defaults {
+		if endpoint == d {
+			return ""
+		}
+	}
+	return endpoint
+}
+
+func (s *policySubject) violations(spec *examplev1alpha1.ImagePullSecretPolicySpec) []string {
+	var violations []string
+	check := func(field, value string, patterns []string) {
+		if value != "" && len(patterns) > 0 && !matchAny(patterns, value) {
+			violations = append(violations, fmt.Sprintf("%s %q is not allowed", field, value))
+		}
+	}
+	check("serviceAccountName", s.serviceAccountName, spec.AllowedServiceAccountNames)
+	for _, e := range s.gsaEmails {
+		check("GSA email", e, spec.AllowedGsaEmails)
+	}
+	check("workload identity pool provider", s.provider, spec.AllowedWorkloadIdentityPoolProviders)
+	for _, r := range s.registries {
+		check("registry", r, spec.AllowedRegistries)
+	}
+	check("OIDC issuer", s.oidcIssuer, spec.AllowedOidcIssuers)
+	check("service account token audience", s.audience, spec.AllowedServiceAccountTokenAudiences)
+	// Endpoint overrides must be allowed explicitly.
+	checkOverride := func(field, value string, patterns []string) {
+		if value != "" && !matchAny(patterns, value) {
+			violations = append(violations, fmt.Sprintf("%s %q is not allowed", field, value))
+		}
+	}
+	checkOverride("STS endpoint", s.stsEndpoint, spec.AllowedStsEndpoints)
+	checkOverride("IAM Credentials endpoint", s.iamCredentialsEndpoint, spec.AllowedIamCredentialsEndpoints)
+	return violations
+}
+
+// matchAny ignores malformed patterns.
+func matchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if ok, err := path.Match(p, value); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// policiesEnforced reports whether ImagePullSecretPolicies are enforced.
+// They are cluster-scoped, so namespace-scoped instances can't watch them and are bound only by their Roles.
+// It is logged at startup and reported by the PolicyCompliant condition with reasonPolicyNotEnforced.
+func (r *ImagePullSecretReconciler) policiesEnforced() bool {
+	return len(r.WatchNamespaces) == 0
+}
+
+// checkPolicy returns *policyViolationError if any policy selects the namespace and none of them allows res.
+// ex may be nil if the credential configuration can't be resolved yet.
+func (r *ImagePullSecretReconciler) checkPolicy(ctx context.Context, res *examplev1alpha1.ImagePullSecret, ex *exchange) error {
+	if !r.policiesEnforced() {
+		return nil
+	}
+	var policies examplev1alpha1.ImagePullSecretPolicyList
+	if err := r.List(ctx, &policies); err != nil {
+		return err
+	}
+	if len(policies.Items) == 0 {
+		return nil
+	}
+	var ns corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: res.Namespace}, &ns); err != nil {
+		return err
+	}
+
+	subject := newPolicySubject(res, ex, r.Settings())
+	selected := false
+	var violations []string
+	for i := range policies.Items {
+		p := &policies.Items[i]
+		selector, err := metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector)
+		if err != nil {
+			// Fail closed because the policy is meant to restrict some namespaces.
+			selected = true
+			violations = append(violations, fmt.Sprintf("%s: invalid namespaceSelector: %v", p.Name, err))
+			continue
+		}
+		if p.Spec.NamespaceSelector == nil {
+			selector = labels.Everything()
+		}
+		if !selector.Matches(labels.Set(ns.Labels)) {
+			continue
+		}
+		selected = true
+		v := subject.violations(&p.Spec)
+		if len(v) == 0 {
+			return nil
+		}
+		for _, m := range v {
+			violations = append(violations, fmt.Sprintf("%s: %s", p.Name, m))
+		}
+	}
+	if !selected {
+		return nil
+	}
+	return &policyViolationError{violations: violations}
+}
+
+// policyCompliant reports false only if the last reconciliation found a violation.
+func policyCompliant(res *examplev1alpha1.ImagePullSecret) bool {
+	return !meta.IsStatusConditionFalse(res.Status.Conditions, examplev1alpha1.ConditionPolicyCompliant)
+}
+
+// imagePullSecretsForPolicy enqueues all ImagePullSecrets because a policy change may allow or deny any of them.
+func (r *ImagePullSecretReconciler) imagePullSecretsForPolicy(client.Object) []reconcile.Request {
+	var list examplev1alpha1.ImagePullSecretList
+	if err := r.List(context.Background(), &list); err != nil {
+		log.Log.Error(err, "unable to list ImagePullSecrets for the policy change")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, res := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: res.Namespace, Name: res.Name}})
+	}
+	return requests
+}
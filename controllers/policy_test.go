@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"testing"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+func TestPolicySubjectViolations(t *testing.T) {
+	spec := &examplev1alpha1.ImagePullSecretPolicySpec{
+		AllowedServiceAccountNames:           []string{"default", "puller-*"},
+		AllowedGsaEmails:                     []string{"*@team-a.iam.gserviceaccount.com"},
+		AllowedWorkloadIdentityPoolProviders: []string{"projects/123/locations/global/workloadIdentityPools/pool/providers/*"},
+		AllowedRegistries:                    []string{"*-docker.pkg.dev"},
+		AllowedOidcIssuers:                   []string{"https://login.example.com/*"},
+		AllowedServiceAccountTokenAudiences:  []string{"https://team-a.example.com/*"},
+		AllowedStsEndpoints:                  []string{"https://sts-*.p.googleapis.com/"},
+	}
+	allowed := policySubject{
+		serviceAccountName: "puller-1",
+		gsaEmails:          []string{"puller@team-a.iam.gserviceaccount.com"},
+		provider:           "projects/123/locations/global/workloadIdentityPools/pool/providers/gke",
+		registries:         []string{"asia-northeast1-docker.pkg.dev"},
+		oidcIssuer:         "https://login.example.com/tenant",
+		audience:           "https://team-a.example.com/gke",
+		stsEndpoint:        "https://sts-xyz.p.googleapis.com/",
+	}
+
+	tests := []struct {
+		desc    string
+		modify  func(s *policySubject)
+		wantLen int
+	}{
+		{"allowed", func(s *policySubject) {}, 0},
+		{"empty values are not checked", func(s *policySubject) { s.serviceAccountName, s.provider = "", "" }, 0},
+		{"service account", func(s *policySubject) { s.serviceAccountName = "admin" }, 1},
+		{"delegate", func(s *policySubject) {
+			s.gsaEmails = append([]string{"admin@team-b.iam.gserviceaccount.com"}, s.gsaEmails...)
+		}, 1},
+		{"provider", func(s *policySubject) {
+			s.provider = "projects/123/locations/global/workloadIdentityPools/other/providers/gke"
+		}, 1},
+		{"registries", func(s *policySubject) { s.registries = []string{"gcr.io", "docker.io"} }, 2},
+		{"OIDC issuer", func(s *policySubject) { s.oidcIssuer = "https://attacker.example.net/" }, 1},
+		{"audience", func(s *policySubject) { s.audience = "https://team-b.example.com/gke" }, 1},
+		{"STS endpoint", func(s *policySubject) { s.stsEndpoint = "https://attacker.example.net/" }, 1},
+		{"IAM Credentials endpoint is denied without patterns", func(s *policySubject) {
+			s.iamCredentialsEndpoint = "iamcredentials-xyz.p.googleapis.com:443"
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			s := allowed
+			tt.modify(&s)
+			if got := s.violations(spec); len(got) != tt.wantLen {
+				t.Errorf("want %d violations, got %q", tt.wantLen, got)
+			}
+		})
+	}
+
+	if got := allowed.violations(&examplev1alpha1.ImagePullSecretPolicySpec{}); len(got) != 1 {
+		t.Errorf("empty policy: want only the STS endpoint override to be denied, got %q", got)
+	}
+}
+
+func TestNewPolicySubjectEndpoints(t *testing.T) {
+	res := &examplev1alpha1.ImagePullSecret{}
+	res.Spec.Endpoints = &examplev1alpha1.EndpointsSpec{STS: "https://sts-psc.p.googleapis.com/"}
+	settings := Settings{IamCredentialsEndpoint: "iamcredentials-psc.p.googleapis.com:443"}
+
+	s := newPolicySubject(res, nil, settings)
+	if s.stsEndpoint != res.Spec.Endpoints.STS || s.iamCredentialsEndpoint != "" {
+		t.Errorf("spec: want only the STS endpoint override, got %q and %q", s.stsEndpoint, s.iamCredentialsEndpoint)
+	}
+
+	// The resolved endpoints include the controller defaults, which are not overrides.
+	ex := &exchange{stsEndpoint: defaultStsEndpoint, iamCredentialsEndpoint: settings.IamCredentialsEndpoint}
+	if s := newPolicySubject(res, ex, settings); s.stsEndpoint != "" || s.iamCredentialsEndpoint != "" {
+		t.Errorf("exchange: want no overrides, got %q and %q", s.stsEndpoint, s.iamCredentialsEndpoint)
+	}
+	ex.iamCredentialsEndpoint = "attacker.example.net:443"
+	if s := newPolicySubject(res, ex, settings); s.iamCredentialsEndpoint != ex.iamCredentialsEndpoint {
+		t.Errorf("exchange: want the IAM Credentials endpoint override, got %q", s.iamCredentialsEndpoint)
+	}
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+const (
+	// defaultPerProjectRequestsPerMinute is far below the default quota of STS and IAM Credentials
+	// so that the controller doesn't starve the other clients in the project.
+	defaultPerProjectRequestsPerMinute = 600
+	defaultPerProjectBurst             = 60
+
+	// reasonThrottled is the reason of the Ready condition when the refresh is deferred by the rate limit.
+	reasonThrottled = "Throttled"
+)
+
+// throttledError is returned when the token exchange would exceed the rate limit of a project.
+type throttledError struct {
+	key        string
+	retryAfter time.Duration
+}
+
+func (e *throttledError) Error() string {
+	return fmt.Sprintf("the token exchange is throttled by the rate limit of %s", e.key)
+}
+
+// projectRateLimiter is a token bucket per GCP project.
+// STS is charged to the project of the workload identity pool, and GenerateAccessToken to the project of the GSA.
+type projectRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// reserve takes a token from each bucket of the keys, or none of them if any bucket is empty.
+// It never blocks so that a throttled project doesn't occupy the workers.
+func (l *projectRateLimiter) reserve(now time.Time, perMinute, burst int, keys ...string) error {
+	if perMinute < 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limiters == nil {
+		l.limiters = make(map[string]*rate.Limiter)
+	}
+	limit := rate.Limit(float64(perMinute) / 60)
+
+	var reservations []*rate.Reservation
+	for _, key := range keys {
+		lim, ok := l.limiters[key]
+		if !ok {
+			lim = rate.NewLimiter(limit, burst)
+			l.limiters[key] = lim
+		} else if lim.Limit() != limit || lim.Burst() != burst {
+			lim.SetLimitAt(now, limit)
+			lim.SetBurstAt(now, burst)
+		}
+		rsv := lim.ReserveN(now, 1)
+		delay := time.Minute
+		if rsv.OK() {
+			delay = rsv.DelayFrom(now)
+		}
+		if delay > 0 {
+			rsv.CancelAt(now)
+			for _, prev := range reservations {
+				prev.CancelAt(now)
+			}
+			return &throttledError{key: key, retryAfter: delay}
+		}
+		reservations = append(reservations, rsv)
+	}
+	return nil
+}
+
+// rateLimitKeys returns the keys of the buckets charged by the token exchange.
+func rateLimitKeys(audience, gsaEmail string) []string {
+	var keys []string
+	// audience is //iam.googleapis.com/projects/<number>/locations/global/workloadIdentityPools/<pool>/providers/<provider>
+	parts := strings.Split(strings.TrimPrefix(audience, "//iam.googleapis.com/"), "/")
+	if len(parts) >= 2 && parts[0] == "projects" {
+		keys = append(keys, "sts:projects/"+parts[1])
+	}
+	// User-managed service accounts are <name>@<project>.iam.gserviceaccount.com.
+	if i := strings.LastIndexByte(gsaEmail, '@'); i >= 0 && strings.HasSuffix(gsaEmail, ".iam.gserviceaccount.com") {
+		keys = append(keys, "iamcredentials:projects/"+strings.TrimSuffix(gsaEmail[i+1:], ".iam.gserviceaccount.com"))
+	} else if gsaEmail != "" {
+		keys = append(keys, "iamcredentials:"+gsaEmail)
+	}
+	return keys
+}
+
+func (r *ImagePullSecretReconciler) reserveTokenExchange(ex *exchange) error {
+	settings := r.Settings()
+	perMinute, burst := settings.perProjectRateLimit()
+	return r.limiter.reserve(time.Now(), perMinute, burst, rateLimitKeys(ex.audience, ex.gsaEmail)...)
+}
+
+// handleThrottled defers the refresh until the bucket is refilled.
+// It is not an error, so the rate limiter of the controller doesn't back off and no Warning event is emitted.
+// The Secret still holds the last good credential.
+func (r *ImagePullSecretReconciler) handleThrottled(ctx context.Context, res *examplev1alpha1.ImagePullSecret, err *throttledError) (ctrl.Result, error) {
+	cond := metav1.Condition{
+		Type:               examplev1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonThrottled,
+		Message:            err.Error(),
+		ObservedGeneration: res.Generation,
+	}
+	result := ctrl.Result{RequeueAfter: err.retryAfter}
+	if result.RequeueAfter < time.Second {
+		result.RequeueAfter = time.Second
+	}
+	// Avoid a status update on every retry.
+	if prev := meta.FindStatusCondition(res.Status.Conditions, cond.Type); prev != nil &&
+		prev.Status == cond.Status && prev.Reason == cond.Reason && prev.Message == cond.Message && prev.ObservedGeneration == cond.ObservedGeneration {
+		return result, nil
+	}
+	meta.SetStatusCondition(&res.Status.Conditions, cond)
+	return result, r.Status().Update(ctx, res)
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	stderrors "errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateLimitKeys(t *testing.T) {
+	got := rateLimitKeys("//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/provider", "puller@service-project.iam.gserviceaccount.com")
+	want := []string{"sts:projects/123", "iamcredentials:projects/service-project"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	got = rateLimitKeys("//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/provider", "123-compute@developer.gserviceaccount.com")
+	want = []string{"sts:projects/123", "iamcredentials:123-compute@developer.gserviceaccount.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestProjectRateLimiter(t *testing.T) {
+	var l projectRateLimiter
+	now := time.Now()
+
+	// The burst of "a" is consumed.
+	for i := 0; i < 2; i++ {
+		if err := l.reserve(now, 60, 2, "a"); err != nil {
+			t.Fatalf("reserve %d: %v", i, err)
+		}
+	}
+	err := l.reserve(now, 60, 2, "b", "a")
+	var throttled *throttledError
+	if !stderrors.As(err, &throttled) || throttled.key != "a" || throttled.retryAfter <= 0 || throttled.retryAfter > time.Second {
+		t.Fatalf("want throttled by a within 1s, got %v", err)
+	}
+	// "b" must not be charged by the throttled exchange.
+	for i := 0; i < 2; i++ {
+		if err := l.reserve(now, 60, 2, "b"); err != nil {
+			t.Fatalf("reserve b %d: %v", i, err)
+		}
+	}
+	// "a" is refilled at 1 per second.
+	if err := l.reserve(now.Add(time.Second), 60, 2, "a"); err != nil {
+		t.Errorf("reserve after refill: %v", err)
+	}
+	// Negative disables the limit.
+	if err := l.reserve(now, -1, 2, "a"); err != nil {
+		t.Errorf("reserve without limit: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
+)
+
+const (
+	// ForceRefreshAnnotation triggers a refresh once per distinct value, e.g. the current time.
+	ForceRefreshAnnotation = "image-pull-secret.apstn.dev/force-refresh"
+	// RotateAtAnnotation schedules a refresh once at the RFC3339 time.
+	RotateAtAnnotation = "image-pull-secret.apstn.dev/rotate-at"
+)
+
+// refreshPlan is whether the credential should be refreshed now, and when it should be refreshed next.
+type refreshPlan struct {
+	due    bool
+	reason string
+	next   time.Time
+	// scheduled is true if the plan is decided by next, so it may be shifted by a jitter.
+	scheduled bool
+	// rewrite is true if the spec is changed only in the fields applied without minting.
+	rewrite bool
+}
+
+// repair makes the plan due to repair the Secret, e.g. deleted or modified.
+// The plan is no longer scheduled, so the startup jitter never defers the repair.
+func (p refreshPlan) repair(reason string) refreshPlan {
+	p.due, p.reason, p.scheduled = true, reason, false
+	return p
+}
+
+// planRefresh decides when res should be refreshed based on the expiry, the annotations and the rotation schedule.
+func planRefresh(res *examplev1alpha1.ImagePullSecret, now time.Time, refreshMargin time.Duration) (refreshPlan, error) {
+	ready := meta.FindStatusCondition(res.Status.Conditions, examplev1alpha1.ConditionReady)
+	switch {
+	case res.Status.ExpiresAt.IsZero():
+		return refreshPlan{due: true, reason: "no credential is minted"}, nil
+	case ready == nil || ready.Status != metav1.ConditionTrue:
+		return refreshPlan{due: true, reason: "the last refresh failed"}, nil
+	case ready.ObservedGeneration != res.Generation && !rewriteOnlyChange(res):
+		return refreshPlan{due: true, reason: "the spec is changed"}, nil
+	}
+	rewrite := ready.ObservedGeneration != res.Generation
+
+	if v, ok := res.Annotations[ForceRefreshAnnotation]; ok && v != res.Status.HandledForceRefresh {
+		return refreshPlan{due: true, reason: fmt.Sprintf("%s=%s", ForceRefreshAnnotation, v)}, nil
+	}
+
+	next := refreshAt(res.Status.LastRefreshTime, res.Status.ExpiresAt.Time, refreshMargin)
+	reason := "the credential is expiring"
+
+	if at, ok := pendingRotateAt(res); ok && at.Before(next) {
+		next, reason = at, fmt.Sprintf("%s=%s", RotateAtAnnotation, res.Annotations[RotateAtAnnotation])
+	}
+
+	if res.Spec.RotationSchedule != "" && res.Status.LastRefreshTime != nil {
+		schedule, err := parseRotationSchedule(res.Spec.RotationSchedule)
+		if err != nil {
+			return refreshPlan{}, err
+		}
+		if at := schedule.Next(res.Status.LastRefreshTime.Time); at.Before(next) {
+			next, reason = at, "rotationSchedule"
+		}
+	}
+
+	return refreshPlan{due: !now.Before(next), reason: reason, next: next, scheduled: true, rewrite: rewrite}, nil
+}
+
+// refreshAt returns when the credential expiring at expiry should be refreshed.
+// Short-lived credentials are refreshed at the half of their lifetime.
+func refreshAt(lastRefresh *metav1.Time, expiry time.Time, refreshMargin time.Duration) time.Time {
+	if lastRefresh != nil {
+		if lifetime := expiry.Sub(lastRefresh.Time); lifetime <= 2*refreshMargin {
+			return lastRefresh.Add(lifetime / 2)
+		}
+	}
+	return expiry.Add(-refreshMargin)
+}
+
+// pendingRotateAt returns the time of the rotate-at annotation if it is valid and not handled yet.
+func pendingRotateAt(res *examplev1alpha1.ImagePullSecret) (time.Time, bool) {
+	v, ok := res.Annotations[RotateAtAnnotation]
+	if !ok || v == res.Status.HandledRotateAt {
+		return time.Time{}, false
+	}
+	at, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+func parseRotationSchedule(s string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(s)
+	if err != nil {
+		return nil, &tokensource.PermanentError{Err: fmt.Errorf("invalid spec.rotationSchedule: %w", err)}
+	}
+	return schedule, nil
+}
+
+// recordRefresh records the refresh at now and the annotations handled by it.
+func recordRefresh(res *examplev1alpha1.ImagePullSecret, now time.Time) {
+	res.Status.LastRefreshTime = &metav1.Time{Time: now}
+	if v, ok := res.Annotations[ForceRefreshAnnotation]; ok {
+		res.Status.HandledForceRefresh = v
+	}
+	if at, ok := pendingRotateAt(res); ok && !now.Before(at) {
+		res.Status.HandledRotateAt = res.Annotations[RotateAtAnnotation]
+	}
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+func TestPlanRefresh(t *testing.T) {
+	lastRefresh := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	margin := 15 * time.Minute
+	minted := func() *examplev1alpha1.ImagePullSecret {
+		return &examplev1alpha1.ImagePullSecret{
+			ObjectMeta: metav1.ObjectMeta{Generation: 1, Annotations: map[string]string{}},
+			Status: examplev1alpha1.ImagePullSecretStatus{
+				ExpiresAt:       metav1.NewTime(lastRefresh.Add(time.Hour)),
+				LastRefreshTime: &metav1.Time{Time: lastRefresh},
+				Conditions: []metav1.Condition{{
+					Type:               examplev1alpha1.ConditionReady,
+					Status:             metav1.ConditionTrue,
+					ObservedGeneration: 1,
+				}},
+			},
+		}
+	}
+
+	tests := []struct {
+		desc     string
+		modify   func(res *examplev1alpha1.ImagePullSecret)
+		now      time.Time
+		wantDue  bool
+		wantNext time.Time
+	}{
+		{"not due", func(res *examplev1alpha1.ImagePullSecret) {}, lastRefresh.Add(time.Minute), false, lastRefresh.Add(45 * time.Minute)},
+		{"expiring", func(res *examplev1alpha1.ImagePullSecret) {}, lastRefresh.Add(45 * time.Minute), true, lastRefresh.Add(45 * time.Minute)},
+		{"short-lived", func(res *examplev1alpha1.ImagePullSecret) {
+			res.Status.ExpiresAt = metav1.NewTime(lastRefresh.Add(20 * time.Minute))
+		}, lastRefresh.Add(time.Minute), false, lastRefresh.Add(10 * time.Minute)},
+		{"spec changed", func(res *examplev1alpha1.ImagePullSecret) { res.Generation = 2 }, lastRefresh.Add(time.Minute), true, time.Time{}},
+		{"secret template changed", func(res *examplev1alpha1.ImagePullSecret) {
+			res.Status.MintedSpecHash = mintedSpecHash(&res.Spec)
+			res.Spec.SecretTemplate = &examplev1alpha1.SecretTemplate{TokenKey: "token"}
+			res.Generation = 2
+		}, lastRefresh.Add(time.Minute), false, lastRefresh.Add(45 * time.Minute)},
+		{"spec changed with secret template", func(res *examplev1alpha1.ImagePullSecret) {
+			res.Status.MintedSpecHash = mintedSpecHash(&res.Spec)
+			res.Spec.SecretTemplate = &examplev1alpha1.SecretTemplate{TokenKey: "token"}
+			res.Spec.GsaEmail = "other@project.iam.gserviceaccount.com"
+			res.Generation = 2
+		}, lastRefresh.Add(time.Minute), true, time.Time{}},
+		{"force refresh", func(res *examplev1alpha1.ImagePullSecret) {
+			res.Annotations[ForceRefreshAnnotation] = "1"
+		}, lastRefresh.Add(time.Minute), true, time.Time{}},
+		{"handled force refresh", func(res *examplev1alpha1.ImagePullSecret) {
+			res.Annotations[ForceRefreshAnnotation] = "1"
+			res.Status.HandledForceRefresh = "1"
+		}, lastRefresh.Add(time.Minute), false, lastRefresh.Add(45 * time.Minute)},
+		{"rotate-at in future", func(res *examplev1alpha1.ImagePullSecret) {
+			res.Annotations[RotateAtAnnotation] = "2021-06-01T00:30:00Z"
+		}, lastRefresh.Add(time.Minute), false, lastRefresh.Add(30 * time.Minute)},
+		{"rotate-at passed", func(res *examplev1alpha1.ImagePullSecret) {
+			res.Annotations[RotateAtAnnotation] = "2021-06-01T00:30:00Z"
+		}, lastRefresh.Add(31 * time.Minute), true, lastRefresh.Add(30 * time.Minute)},
+		{"handled rotate-at", func(res *examplev1alpha1.ImagePullSecret) {
+			res.Annotations[RotateAtAnnotation] = "2021-06-01T00:30:00Z"
+			res.Status.HandledRotateAt = "2021-06-01T00:30:00Z"
+		}, lastRefresh.Add(31 * time.Minute), false, lastRefresh.Add(45 * time.Minute)},
+		{"rotation schedule", func(res *examplev1alpha1.ImagePullSecret) {
+			res.Spec.RotationSchedule = "*/20 * * * *"
+		}, lastRefresh.Add(time.Minute), false, lastRefresh.Add(20 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			res := minted()
+			tt.modify(res)
+			plan, err := planRefresh(res, tt.now, margin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan.due != tt.wantDue {
+				t.Errorf("due: want %v, got %v (%s)", tt.wantDue, plan.due, plan.reason)
+			}
+			if !plan.next.Equal(tt.wantNext) {
+				t.Errorf("next: want %v, got %v", tt.wantNext, plan.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
+)
+
+// mintedSpecHash returns the hash of the spec fields which affect the minted credential.
+func mintedSpecHash(spec *examplev1alpha1.ImagePullSecretSpec) string {
+	s := spec.DeepCopy()
+	s.SecretTemplate = nil
+	s.Outputs = nil
+	b, _ := json.Marshal(s)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// rewriteOnlyChange reports whether the spec is changed since the last refresh only in the fields applied without minting,
+// i.e. spec.secretTemplate and spec.outputs.
+func rewriteOnlyChange(res *examplev1alpha1.ImagePullSecret) bool {
+	return res.Status.MintedSpecHash != "" && res.Status.MintedSpecHash == mintedSpecHash(&res.Spec)
+}
+
+func validateSecretTemplate(t *examplev1alpha1.SecretTemplate) error {
+	if _, ok := t.Metadata.Labels[SecretOwnerLabel]; ok {
+		return &tokensource.PermanentError{Err: fmt.Errorf("spec.secretTemplate.metadata.labels: %s is reserved", SecretOwnerLabel)}
+	}
+	keys := map[string]string{corev1.DockerConfigJsonKey: "the docker config"}
+	for _, k := range []struct{ field, key string }{{"tokenKey", t.TokenKey}, {"expiryKey", t.ExpiryKey}} {
+		if k.key == "" {
+			continue
+		}
+		if msgs := validation.IsConfigMapKey(k.key); len(msgs) != 0 {
+			return &tokensource.PermanentError{Err: fmt.Errorf("spec.secretTemplate.%s: %q: %s", k.field, k.key, strings.Join(msgs, ", "))}
+		}
+		if other, ok := keys[k.key]; ok {
+			return &tokensource.PermanentError{Err: fmt.Errorf("spec.secretTemplate.%s: %q is already used by %s", k.field, k.key, other)}
+		}
+		keys[k.key] = k.field
+	}
+	return nil
+}
+
+// applySecretTemplate replaces the metadata and the keys other than .dockerconfigjson of the Secret by spec.secretTemplate.
+// The Secret is owned by the controller, so labels and annotations not in the template are removed.
+func applySecretTemplate(secret *corev1.Secret, res *examplev1alpha1.ImagePullSecret, token *oauth2.Token) {
+	applyTemplateMetadata(&secret.ObjectMeta, res)
+	data := map[string][]byte{corev1.DockerConfigJsonKey: secret.Data[corev1.DockerConfigJsonKey]}
+	if t := res.Spec.SecretTemplate; t != nil {
+		if t.TokenKey != "" {
+			data[t.TokenKey] = []byte(token.AccessToken)
+		}
+		if t.ExpiryKey != "" {
+			data[t.ExpiryKey] = []byte(token.Expiry.UTC().Format(time.RFC3339))
+		}
+	}
+	secret.Data = data
+}
+
+// applyTemplateMetadata replaces the labels and the annotations of the object generated for res by spec.secretTemplate.
+func applyTemplateMetadata(meta *metav1.ObjectMeta, res *examplev1alpha1.ImagePullSecret) {
+	labels := map[string]string{}
+	var annotations map[string]string
+	if t := res.Spec.SecretTemplate; t != nil {
+		for k, v := range t.Metadata.Labels {
+			labels[k] = v
+		}
+		if len(t.Metadata.Annotations) > 0 {
+			annotations = make(map[string]string, len(t.Metadata.Annotations))
+			for k, v := range t.Metadata.Annotations {
+				annotations[k] = v
+			}
+		}
+	}
+	labels[SecretOwnerLabel] = res.Name
+	meta.Labels = labels
+	meta.Annotations = annotations
+}
+
+// rewrite writes the current Secret and the outputs with the credential in the Secret,
+// and marks the spec as observed. It returns false if the Secret has no credential to reuse.
+func (r *ImagePullSecretReconciler) rewrite(ctx context.Context, res *examplev1alpha1.ImagePullSecret) (bool, error) {
+	if err := validate(res); err != nil {
+		return false, err
+	}
+	secret, err := r.ClientSet.CoreV1().Secrets(res.Namespace).Get(ctx, currentSecretName(res), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	accessToken := accessTokenOf(secret)
+	if accessToken == "" {
+		return false, nil
+	}
+	token := &oauth2.Token{AccessToken: accessToken, Expiry: res.Status.ExpiresAt.Time}
+	applySecretTemplate(secret, res, token)
+	secret, err = r.ClientSet.CoreV1().Secrets(res.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return false, err
+	}
+	r.written.record(secret)
+	res.Status.SecretHash = secretHash(secret.Data)
+	if err := r.writeOutputs(ctx, res, accessToken); err != nil {
+		return false, err
+	}
+
+	// The conditions still hold for the new generation.
+	for i := range res.Status.Conditions {
+		res.Status.Conditions[i].ObservedGeneration = res.Generation
+	}
+	return true, r.Status().Update(ctx, res)
+}
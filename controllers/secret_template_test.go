@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+func TestApplySecretTemplate(t *testing.T) {
+	res := &examplev1alpha1.ImagePullSecret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample"},
+		Spec: examplev1alpha1.ImagePullSecretSpec{SecretTemplate: &examplev1alpha1.SecretTemplate{
+			Metadata: examplev1alpha1.SecretTemplateMetadata{
+				Labels:      map[string]string{"app": "puller"},
+				Annotations: map[string]string{"reflector.v1.k8s.emberstack.com/reflection-allowed": "true"},
+			},
+			TokenKey:  "token",
+			ExpiryKey: "expiry",
+		}},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"stale": "true"}},
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("{}"), "stale": []byte("x")},
+	}
+	applySecretTemplate(secret, res, &oauth2.Token{AccessToken: "ya29.x", Expiry: time.Date(2021, 6, 1, 1, 0, 0, 0, time.UTC)})
+
+	wantLabels := map[string]string{"app": "puller", SecretOwnerLabel: "sample"}
+	if !reflect.DeepEqual(secret.Labels, wantLabels) {
+		t.Errorf("want labels %v, got %v", wantLabels, secret.Labels)
+	}
+	if !reflect.DeepEqual(secret.Annotations, res.Spec.SecretTemplate.Metadata.Annotations) {
+		t.Errorf("want annotations %v, got %v", res.Spec.SecretTemplate.Metadata.Annotations, secret.Annotations)
+	}
+	wantData := map[string][]byte{
+		corev1.DockerConfigJsonKey: []byte("{}"),
+		"token":                    []byte("ya29.x"),
+		"expiry":                   []byte("2021-06-01T01:00:00Z"),
+	}
+	if !reflect.DeepEqual(secret.Data, wantData) {
+		t.Errorf("want data %q, got %q", wantData, secret.Data)
+	}
+}
+
+func TestValidateSecretTemplate(t *testing.T) {
+	tests := []struct {
+		desc     string
+		template examplev1alpha1.SecretTemplate
+		wantErr  bool
+	}{
+		{"valid", examplev1alpha1.SecretTemplate{TokenKey: "token", ExpiryKey: "expiry"}, false},
+		{"reserved label", examplev1alpha1.SecretTemplate{Metadata: examplev1alpha1.SecretTemplateMetadata{
+			Labels: map[string]string{SecretOwnerLabel: "other"},
+		}}, true},
+		{"docker config key", examplev1alpha1.SecretTemplate{TokenKey: corev1.DockerConfigJsonKey}, true},
+		{"duplicate keys", examplev1alpha1.SecretTemplate{TokenKey: "token", ExpiryKey: "token"}, true},
+		{"invalid key", examplev1alpha1.SecretTemplate{TokenKey: "a/b"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateSecretTemplate(&tt.template); (err != nil) != tt.wantErr {
+			t.Errorf("%s: want error %v, got %v", tt.desc, tt.wantErr, err)
+		}
+	}
+}
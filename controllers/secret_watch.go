@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=list;watch
+
+// SecretOwnerLabel on a generated Secret is the name of the ImagePullSecret which manages it.
+// Only Secrets with this label are watched.
+const SecretOwnerLabel = "image-pull-secret.apstn.dev/owner"
+
+// secretHash returns the hash of the content of the Secret to detect modifications.
+func secretHash(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%d:", key, len(data[key]))
+		h.Write(data[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writtenSecrets records the hashes of the Secrets written by the controller since it started.
+type writtenSecrets struct {
+	mu     sync.Mutex
+	hashes map[types.NamespacedName]string
+}
+
+func (w *writtenSecrets) record(secret *corev1.Secret) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hashes == nil {
+		w.hashes = make(map[types.NamespacedName]string)
+	}
+	w.hashes[types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}] = secretHash(secret.Data)
+}
+
+func (w *writtenSecrets) lookup(key types.NamespacedName) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	hash, ok := w.hashes[key]
+	return hash, ok
+}
+
+func (w *writtenSecrets) forget(key types.NamespacedName) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.hashes, key)
+}
+
+// secretDrift returns why the current Secret of res must be repaired, or empty if it is intact.
+// The content is compared with the hash written since the controller started,
+// or with status.secretHash for the first time after a restart.
+func (r *ImagePullSecretReconciler) secretDrift(ctx context.Context, res *examplev1alpha1.ImagePullSecret) (string, error) {
+	name := currentSecretName(res)
+	// Use the clientset not to cache all Secrets in the cluster.
+	secret, err := r.ClientSet.CoreV1().Secrets(res.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return fmt.Sprintf("the Secret %s is deleted", name), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	key := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+	want, ok := r.written.lookup(key)
+	if !ok && res.Status.SecretHash != "" {
+		want, ok = res.Status.SecretHash, true
+	}
+	if !ok {
+		return "", nil
+	}
+	if want != secretHash(secret.Data) {
+		return fmt.Sprintf("the Secret %s is modified", name), nil
+	}
+	// Trust the intact Secret from now on.
+	r.written.record(secret)
+	return "", nil
+}
+
+// watchSecrets watches the metadata of the Secrets labeled with SecretOwnerLabel,
+// so that deletions and modifications are repaired without holding all Secrets in the cluster in memory.
+func (r *ImagePullSecretReconciler) watchSecrets(mgr ctrl.Manager, b *builder.Builder) (*builder.Builder, error) {
+	mdClient, err := metadata.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	namespaces := r.WatchNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	// Creations are ignored because the controller creates the Secrets, and the initial list would enqueue everything.
+	// The metadata doesn't include the data, so any update is checked by secretDrift.
+	predicates := builder.WithPredicates(
+		predicate.Funcs{CreateFunc: func(event.CreateEvent) bool { return false }},
+		predicate.ResourceVersionChangedPredicate{},
+	)
+	for _, ns := range namespaces {
+		factory := metadatainformer.NewFilteredSharedInformerFactory(mdClient, 0, ns, func(o *metav1.ListOptions) {
+			o.LabelSelector = SecretOwnerLabel
+		})
+		informer := factory.ForResource(corev1.SchemeGroupVersion.WithResource("secrets")).Informer()
+		r.health.secretInformers = append(r.health.secretInformers, informer)
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			factory.Start(ctx.Done())
+			<-ctx.Done()
+			return nil
+		})); err != nil {
+			return nil, err
+		}
+		b = b.Watches(&source.Informer{Informer: informer}, handler.EnqueueRequestsFromMapFunc(imagePullSecretForSecret), predicates)
+	}
+	return b, nil
+}
+
+func imagePullSecretForSecret(obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()[SecretOwnerLabel]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
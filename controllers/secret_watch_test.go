@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSecretHash(t *testing.T) {
+	a := secretHash(map[string][]byte{"a": []byte("bc"), "d": []byte("e")})
+	if a != secretHash(map[string][]byte{"d": []byte("e"), "a": []byte("bc")}) {
+		t.Errorf("the hash must not depend on the order of the keys")
+	}
+	if a == secretHash(map[string][]byte{"a": []byte("b"), "d": []byte("ce")}) {
+		t.Errorf("the hash must change when a value moves to another key")
+	}
+}
+
+func TestImagePullSecretForSecret(t *testing.T) {
+	secret := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "image-pull-secret",
+		Labels:    map[string]string{SecretOwnerLabel: "imagepullsecret-sample"},
+	}}
+	reqs := imagePullSecretForSecret(secret)
+	if len(reqs) != 1 || reqs[0].NamespacedName != (types.NamespacedName{Namespace: "default", Name: "imagepullsecret-sample"}) {
+		t.Errorf("unexpected requests: %v", reqs)
+	}
+	secret.Labels = nil
+	if reqs := imagePullSecretForSecret(secret); len(reqs) != 0 {
+		t.Errorf("unlabeled Secret must be ignored: %v", reqs)
+	}
+}
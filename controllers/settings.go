@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+)
+
+// Settings are the controller-wide settings which can be replaced while the controller is running.
+// Zero values mean the defaults.
+type Settings struct {
+	// DefaultRegistries replace the public hostnames of Container Registry and Artifact Registry if not empty.
+	DefaultRegistries []string
+	// ExtraRegistries are hostnames written to all Secrets in addition to DefaultRegistries.
+	ExtraRegistries []string
+	// RefreshMargin is how long before the expiry the credential is refreshed.
+	RefreshMargin time.Duration
+	// DefaultScopes are used if spec.scopes is empty.
+	DefaultScopes []string
+
+	// StsEndpoint and IamCredentialsEndpoint override the default endpoints, e.g. Private Service Connect endpoints.
+	StsEndpoint            string
+	IamCredentialsEndpoint string
+
+	// AllowLocalSubjectTokenSources allows subject token sources which run in the controller, i.e. file and executable.
+	AllowLocalSubjectTokenSources bool
+	// InjectByDefault enables the injection of imagePullSecrets in namespaces without InjectLabel.
+	InjectByDefault bool
+	// SkipRequesterAuthorization disables SubjectAccessReview of the requester, e.g. without the webhook.
+	SkipRequesterAuthorization bool
+
+	// PerProjectRequestsPerMinute is the sustained rate of token exchanges per GCP project. Negative disables the limit.
+	PerProjectRequestsPerMinute int
+	// PerProjectBurst is the number of token exchanges per GCP project allowed at once.
+	PerProjectBurst int
+
+	// StartupRefreshJitter bounds the random shift of the first refresh scheduled for each ImagePullSecret by the replica.
+	// Nil means the default, and zero disables the jitter.
+	StartupRefreshJitter *time.Duration
+
+	// SkipConnectivityCheck makes the controller ready without reaching STS and IAM Credentials.
+	SkipConnectivityCheck bool
+	// ExpiredCredentialsThresholdPercent is the percentage of expired credentials above which the controller is unhealthy.
+	// Nil means the default, and zero reports any expired credential.
+	ExpiredCredentialsThresholdPercent *int
+}
+
+func (s *Settings) refreshMargin() time.Duration {
+	if s.RefreshMargin > 0 {
+		return s.RefreshMargin
+	}
+	return defaultRefreshMargin
+}
+
+func (s *Settings) perProjectRateLimit() (perMinute, burst int) {
+	perMinute, burst = s.PerProjectRequestsPerMinute, s.PerProjectBurst
+	if perMinute == 0 {
+		perMinute = defaultPerProjectRequestsPerMinute
+	}
+	if burst <= 0 {
+		burst = defaultPerProjectBurst
+	}
+	return perMinute, burst
+}
+
+func (s *Settings) startupRefreshJitter() time.Duration {
+	if s.StartupRefreshJitter != nil {
+		return *s.StartupRefreshJitter
+	}
+	return defaultStartupRefreshJitter
+}
+
+func (s *Settings) expiredCredentialsThresholdPercent() int {
+	if s.ExpiredCredentialsThresholdPercent != nil {
+		return *s.ExpiredCredentialsThresholdPercent
+	}
+	return defaultExpiredCredentialsThresholdPercent
+}
+
+func (s *Settings) defaultScopes() []string {
+	if len(s.DefaultScopes) > 0 {
+		return s.DefaultScopes
+	}
+	return defaultScopes
+}
+
+func (s *Settings) defaultRegistries() []string {
+	if len(s.DefaultRegistries) > 0 {
+		return append([]string{}, s.DefaultRegistries...)
+	}
+	return defaultRegistries()
+}
+
+func (r *ImagePullSecretReconciler) refreshMargin() time.Duration {
+	settings := r.Settings()
+	return settings.refreshMargin()
+}
+
+// settingsHolder guards Settings which are read by concurrent reconciliations and replaced on reload.
+type settingsHolder struct {
+	mu       sync.RWMutex
+	settings Settings
+}
+
+// Settings returns the current settings. Callers must not modify the slices.
+func (r *ImagePullSecretReconciler) Settings() Settings {
+	r.settings.mu.RLock()
+	defer r.settings.mu.RUnlock()
+	return r.settings.settings
+}
+
+// SetSettings replaces the settings. It takes effect from the next reconciliation of each ImagePullSecret.
+func (r *ImagePullSecretReconciler) SetSettings(s Settings) {
+	r.settings.mu.Lock()
+	defer r.settings.mu.Unlock()
+	r.settings.settings = s
+}
@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/utils/pointer"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// shardLeasePrefix is the prefix of the Leases of the shards and the members.
+	shardLeasePrefix = "image-pull-secret-controller"
+	// shardMemberLabel marks the Leases which represent live replicas.
+	shardMemberLabel = "image-pull-secret.apstn.dev/shard-member"
+
+	shardLeaseDuration = 15 * time.Second
+	shardRenewPeriod   = 5 * time.Second
+
+	// defaultStartupRefreshJitter bounds the jitter of the first refresh scheduled by a replica.
+	defaultStartupRefreshJitter = 5 * time.Minute
+)
+
+var shardLog = logf.Log.WithName("shard")
+
+// ShardingOptions splits the namespaces into shards by hash. Each shard is reconciled by the replica holding its Lease.
+type ShardingOptions struct {
+	// Count is the number of shards. Zero or one disables sharding.
+	Count int
+	// Identity is the unique name of the replica, e.g. the Pod name.
+	Identity string
+	// LeaseNamespace is the namespace of the Leases, typically the namespace of the controller.
+	LeaseNamespace string
+}
+
+func (o *ShardingOptions) enabled() bool {
+	return o.Count > 1
+}
+
+// validate checks that the Leases can be named after the options.
+func (o *ShardingOptions) validate() error {
+	if o.Identity == "" || o.LeaseNamespace == "" {
+		return fmt.Errorf("sharding requires the identity and the namespace of the Leases")
+	}
+	for _, name := range []string{memberLeaseName(o.Identity), shardLeaseName(o.Count - 1)} {
+		if msgs := validation.IsDNS1123Subdomain(name); len(msgs) != 0 {
+			return fmt.Errorf("invalid Lease name %q: %s", name, strings.Join(msgs, ", "))
+		}
+	}
+	return nil
+}
+
+// ShardIdentity returns the identity of the replica running on the host, which is valid in the Lease names.
+// The suffix distinguishes a restarted Pod from its predecessor whose Leases may not be expired yet.
+func ShardIdentity(hostname string) string {
+	return strings.ToLower(hostname) + "-" + string(uuid.NewUUID())
+}
+
+// shardOf returns the shard of the namespace.
+func shardOf(namespace string, count int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(namespace))
+	return int(h.Sum32() % uint32(count))
+}
+
+// shardManager acquires a fair share of the shard Leases and renews them.
+// Replicas announce themselves by member Leases, so each replica holds at most ceil(shards/replicas) shards
+// and releases the excess when a replica joins.
+type shardManager struct {
+	options   ShardingOptions
+	clientset kubernetes.Interface
+	// onAcquire is called when a shard is newly acquired, e.g. to enqueue the ImagePullSecrets in it.
+	onAcquire func(shard int)
+
+	mu sync.RWMutex
+	// validUntil is when the ownership of each held shard lapses unless it is renewed.
+	validUntil map[int]time.Time
+}
+
+func newShardManager(options ShardingOptions, clientset kubernetes.Interface, onAcquire func(shard int)) *shardManager {
+	return &shardManager{
+		options:    options,
+		clientset:  clientset,
+		onAcquire:  onAcquire,
+		validUntil: make(map[int]time.Time),
+	}
+}
+
+// owns reports whether the replica holds the shard of the namespace.
+func (m *shardManager) owns(namespace string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	until, ok := m.validUntil[shardOf(namespace, m.options.Count)]
+	return ok && time.Now().Before(until)
+}
+
+// Start implements manager.Runnable.
+func (m *shardManager) Start(ctx context.Context) error {
+	ticker := time.NewTicker(shardRenewPeriod)
+	defer ticker.Stop()
+	for {
+		m.sync(ctx)
+		select {
+		case <-ctx.Done():
+			m.releaseAll()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. All replicas take part in sharding.
+func (m *shardManager) NeedLeaderElection() bool {
+	return false
+}
+
+func (m *shardManager) memberLeaseName() string {
+	return memberLeaseName(m.options.Identity)
+}
+
+func memberLeaseName(identity string) string {
+	return fmt.Sprintf("%s-member-%s", shardLeasePrefix, identity)
+}
+
+func shardLeaseName(shard int) string {
+	return fmt.Sprintf("%s-shard-%d", shardLeasePrefix, shard)
+}
+
+func (m *shardManager) sync(ctx context.Context) {
+	now := time.Now()
+	if err := m.renewMember(ctx, now); err != nil {
+		shardLog.Error(err, "unable to renew the member Lease")
+		return
+	}
+	replicas, err := m.liveReplicas(ctx, now)
+	if err != nil {
+		shardLog.Error(err, "unable to count the replicas")
+		return
+	}
+	limit := (m.options.Count + replicas - 1) / replicas
+
+	held := 0
+	for shard := 0; shard < m.options.Count; shard++ {
+		lease, err := m.leases().Get(ctx, shardLeaseName(shard), metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			shardLog.Error(err, "unable to get the shard Lease", "shard", shard)
+			continue
+		}
+		if err != nil {
+			lease = nil
+		}
+		mine := lease != nil && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == m.options.Identity
+		switch {
+		case mine && held >= limit:
+			// Give the excess to the new replicas.
+			m.release(ctx, shard, lease)
+		case mine:
+			if m.hold(ctx, shard, lease, now, false) {
+				held++
+			}
+		case held < limit && leaseAvailable(lease, now):
+			if m.hold(ctx, shard, lease, now, true) {
+				held++
+			}
+		default:
+			m.forget(shard)
+		}
+	}
+}
+
+// leaseAvailable reports whether nobody holds the Lease or its holder failed to renew it.
+func leaseAvailable(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease == nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return true
+	}
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return now.After(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+func (m *shardManager) leases() coordinationv1client.LeaseInterface {
+	return m.clientset.CoordinationV1().Leases(m.options.LeaseNamespace)
+}
+
+// hold acquires or renews the Lease. The update is conditional on the resourceVersion, so only one replica wins.
+func (m *shardManager) hold(ctx context.Context, shard int, lease *coordinationv1.Lease, now time.Time, acquire bool) bool {
+	renewTime := metav1.NewMicroTime(now)
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       pointer.StringPtr(m.options.Identity),
+		LeaseDurationSeconds: pointer.Int32Ptr(int32(shardLeaseDuration / time.Second)),
+		RenewTime:            &renewTime,
+	}
+	var err error
+	if lease == nil {
+		spec.AcquireTime = &renewTime
+		_, err = m.leases().Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: shardLeaseName(shard), Namespace: m.options.LeaseNamespace},
+			Spec:       spec,
+		}, metav1.CreateOptions{})
+	} else {
+		if acquire {
+			spec.AcquireTime = &renewTime
+			spec.LeaseTransitions = pointer.Int32Ptr(leaseTransitions(lease) + 1)
+		} else {
+			spec.AcquireTime = lease.Spec.AcquireTime
+			spec.LeaseTransitions = lease.Spec.LeaseTransitions
+		}
+		lease = lease.DeepCopy()
+		lease.Spec = spec
+		_, err = m.leases().Update(ctx, lease, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		if !errors.IsConflict(err) && !errors.IsAlreadyExists(err) {
+			shardLog.Error(err, "unable to hold the shard Lease", "shard", shard)
+		}
+		// Keep the ownership until it lapses, because a failed renewal may be transient.
+		return false
+	}
+
+	m.mu.Lock()
+	_, held := m.validUntil[shard]
+	m.validUntil[shard] = now.Add(shardLeaseDuration)
+	m.mu.Unlock()
+	if !held {
+		shardLog.Info("acquired the shard", "shard", shard, "identity", m.options.Identity)
+		if m.onAcquire != nil {
+			m.onAcquire(shard)
+		}
+	}
+	return true
+}
+
+func leaseTransitions(lease *coordinationv1.Lease) int32 {
+	if lease.Spec.LeaseTransitions == nil {
+		return 0
+	}
+	return *lease.Spec.LeaseTransitions
+}
+
+// release gives up the shard so that another replica acquires it without waiting for the expiry.
+func (m *shardManager) release(ctx context.Context, shard int, lease *coordinationv1.Lease) {
+	m.forget(shard)
+	lease = lease.DeepCopy()
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.RenewTime = nil
+	if _, err := m.leases().Update(ctx, lease, metav1.UpdateOptions{}); err != nil && !errors.IsConflict(err) {
+		shardLog.Error(err, "unable to release the shard Lease", "shard", shard)
+		return
+	}
+	shardLog.Info("released the shard", "shard", shard, "identity", m.options.Identity)
+}
+
+func (m *shardManager) forget(shard int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.validUntil, shard)
+}
+
+// releaseAll releases the held shards and the member Lease on shutdown, so that the others take over promptly.
+func (m *shardManager) releaseAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), shardRenewPeriod)
+	defer cancel()
+	m.mu.RLock()
+	var shards []int
+	for shard := range m.validUntil {
+		shards = append(shards, shard)
+	}
+	m.mu.RUnlock()
+	for _, shard := range shards {
+		lease, err := m.leases().Get(ctx, shardLeaseName(shard), metav1.GetOptions{})
+		if err == nil && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == m.options.Identity {
+			m.release(ctx, shard, lease)
+		}
+	}
+	if err := m.leases().Delete(ctx, m.memberLeaseName(), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		shardLog.Error(err, "unable to delete the member Lease")
+	}
+}
+
+func (m *shardManager) renewMember(ctx context.Context, now time.Time) error {
+	renewTime := metav1.NewMicroTime(now)
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       pointer.StringPtr(m.options.Identity),
+		LeaseDurationSeconds: pointer.Int32Ptr(int32(shardLeaseDuration / time.Second)),
+		RenewTime:            &renewTime,
+	}
+	lease, err := m.leases().Get(ctx, m.memberLeaseName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = m.leases().Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      m.memberLeaseName(),
+				Namespace: m.options.LeaseNamespace,
+				Labels:    map[string]string{shardMemberLabel: "true"},
+			},
+			Spec: spec,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	lease.Spec = spec
+	_, err = m.leases().Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// liveReplicas counts the member Leases renewed recently, including the one of this replica.
+// Stale member Leases of crashed replicas are deleted.
+func (m *shardManager) liveReplicas(ctx context.Context, now time.Time) (int, error) {
+	list, err := m.leases().List(ctx, metav1.ListOptions{LabelSelector: shardMemberLabel + "=true"})
+	if err != nil {
+		return 0, err
+	}
+	replicas := 0
+	for i := range list.Items {
+		lease := &list.Items[i]
+		if lease.Name == m.memberLeaseName() || !leaseAvailable(lease, now) {
+			replicas++
+			continue
+		}
+		// Expired for more than a lease duration.
+		if leaseAvailable(lease, now.Add(-shardLeaseDuration)) {
+			_ = m.leases().Delete(ctx, lease.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &lease.UID}})
+		}
+	}
+	if replicas == 0 {
+		replicas = 1
+	}
+	return replicas, nil
+}
+
+// startupJitter spreads the refreshes of the ImagePullSecrets which the replica sees for the first time,
+// e.g. after a restart or a shard handover, so that the credentials minted together are not refreshed together forever.
+type startupJitter struct {
+	mu   sync.Mutex
+	seen map[types.NamespacedName]bool
+	rand *rand.Rand
+}
+
+// apply shifts the scheduled refresh of the plan by a random duration within max,
+// only for the first time key is seen, and never beyond the expiry.
+// Refreshes which are due for other reasons than the schedule, e.g. a failure or a spec change, are not deferred.
+func (j *startupJitter) apply(key types.NamespacedName, expiresAt time.Time, plan refreshPlan, now time.Time, max time.Duration) refreshPlan {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.seen == nil {
+		j.seen = make(map[types.NamespacedName]bool)
+		j.rand = rand.New(rand.NewSource(now.UnixNano()))
+	}
+	if j.seen[key] {
+		return plan
+	}
+	j.seen[key] = true
+	if !plan.scheduled || max <= 0 {
+		return plan
+	}
+
+	if plan.due {
+		// Defer the overdue refresh within the first half of the remaining lifetime.
+		window := expiresAt.Sub(now) / 2
+		if window > max {
+			window = max
+		}
+		if window <= 0 {
+			return plan
+		}
+		plan.due = false
+		plan.next = now.Add(time.Duration(j.rand.Int63n(int64(window))))
+		return plan
+	}
+	// Advance the refresh, which never risks the expiry.
+	window := plan.next.Sub(now)
+	if window > max {
+		window = max
+	}
+	if window > 0 {
+		plan.next = plan.next.Add(-time.Duration(j.rand.Int63n(int64(window))))
+	}
+	return plan
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestShardOf(t *testing.T) {
+	counts := make([]int, 4)
+	for i := 0; i < 400; i++ {
+		ns := fmt.Sprintf("team-%d", i)
+		shard := shardOf(ns, 4)
+		if shard != shardOf(ns, 4) {
+			t.Fatalf("%s: unstable shard", ns)
+		}
+		counts[shard]++
+	}
+	for shard, n := range counts {
+		if n < 50 {
+			t.Errorf("shard %d has only %d of 400 namespaces", shard, n)
+		}
+	}
+}
+
+func TestShardLeaseNames(t *testing.T) {
+	options := ShardingOptions{Count: 16, Identity: ShardIdentity("Controller-Manager-6d4b75cb6d-ABCDE"), LeaseNamespace: "image-pull-secret-controller"}
+	if err := options.validate(); err != nil {
+		t.Error(err)
+	}
+	for _, name := range []string{memberLeaseName(options.Identity), shardLeaseName(0), shardLeaseName(15)} {
+		if msgs := validation.IsDNS1123Subdomain(name); len(msgs) != 0 {
+			t.Errorf("%s: %v", name, msgs)
+		}
+	}
+	options.Identity = "host_1"
+	if err := options.validate(); err == nil {
+		t.Error("want error for the identity with an underscore")
+	}
+}
+
+func TestShardManagerRebalance(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	held := func(m *shardManager) int {
+		n := 0
+		for shard := 0; shard < 4; shard++ {
+			if m.owns(fmt.Sprintf("ns-%d", shard)) {
+				n++
+			}
+		}
+		return n
+	}
+	acquired := map[string][]int{}
+	newManager := func(identity string) *shardManager {
+		return newShardManager(ShardingOptions{Count: 4, Identity: identity, LeaseNamespace: "system"}, clientset, func(shard int) {
+			acquired[identity] = append(acquired[identity], shard)
+		})
+	}
+
+	a := newManager("a")
+	a.sync(ctx)
+	if len(acquired["a"]) != 4 {
+		t.Fatalf("want all shards acquired by a, got %v", acquired["a"])
+	}
+
+	// b can't take the shards renewed by a until a releases the excess.
+	b := newManager("b")
+	b.sync(ctx)
+	if len(acquired["b"]) != 0 {
+		t.Fatalf("want no shards acquired by b, got %v", acquired["b"])
+	}
+	a.sync(ctx)
+	b.sync(ctx)
+	if len(acquired["a"]) != 4 || len(acquired["b"]) != 2 {
+		t.Fatalf("want 2 shards acquired by b, got a=%v b=%v", acquired["a"], acquired["b"])
+	}
+	for i := 0; i < 4; i++ {
+		ns := fmt.Sprintf("ns-%d", i)
+		if a.owns(ns) == b.owns(ns) {
+			t.Errorf("%s: want owned by exactly one replica, got a=%v b=%v", ns, a.owns(ns), b.owns(ns))
+		}
+	}
+
+	// The shards of a replica which stops are taken over.
+	a.releaseAll()
+	b.sync(ctx)
+	if got := held(b); got != 4 {
+		t.Errorf("want 4 shards held by b after a stops, got %d", got)
+	}
+}
+
+func TestStartupJitter(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(30 * time.Minute)
+	key := types.NamespacedName{Namespace: "default", Name: "a"}
+
+	var j startupJitter
+	overdue := refreshPlan{due: true, next: now.Add(-time.Minute), scheduled: true}
+	got := j.apply(key, expiresAt, overdue, now, 5*time.Minute)
+	if got.due || got.next.Before(now) || !got.next.Before(now.Add(5*time.Minute)) {
+		t.Errorf("want the overdue refresh deferred within 5m, got %+v", got)
+	}
+	// Only the first plan of a key is shifted.
+	if got := j.apply(key, expiresAt, overdue, now, 5*time.Minute); got != overdue {
+		t.Errorf("want the plan unchanged for the second time, got %+v", got)
+	}
+
+	failed := refreshPlan{due: true}
+	if got := j.apply(types.NamespacedName{Namespace: "default", Name: "b"}, expiresAt, failed, now, 5*time.Minute); got != failed {
+		t.Errorf("want the unscheduled refresh not deferred, got %+v", got)
+	}
+
+	// The deferral never exceeds the half of the remaining lifetime.
+	got = j.apply(types.NamespacedName{Namespace: "default", Name: "c"}, now.Add(2*time.Minute), overdue, now, 5*time.Minute)
+	if got.due || !got.next.Before(now.Add(time.Minute)) {
+		t.Errorf("want the refresh deferred within 1m, got %+v", got)
+	}
+
+	scheduled := refreshPlan{next: now.Add(time.Hour), scheduled: true}
+	got = j.apply(types.NamespacedName{Namespace: "default", Name: "d"}, expiresAt, scheduled, now, 5*time.Minute)
+	if got.next.After(scheduled.next) || got.next.Before(scheduled.next.Add(-5*time.Minute)) {
+		t.Errorf("want the scheduled refresh advanced within 5m, got %+v", got)
+	}
+
+	// An explicit zero disables the jitter instead of falling back to the default.
+	zero := time.Duration(0)
+	if got := (&Settings{}).startupRefreshJitter(); got != defaultStartupRefreshJitter {
+		t.Errorf("want the default jitter, got %v", got)
+	}
+	if got := (&Settings{StartupRefreshJitter: &zero}).startupRefreshJitter(); got != 0 {
+		t.Errorf("want no jitter, got %v", got)
+	}
+
+	// The Secret deleted while the replica was down is repaired on the first reconcile.
+	deleted := scheduled.repair("the Secret is deleted")
+	if got := j.apply(types.NamespacedName{Namespace: "default", Name: "e"}, expiresAt, deleted, now, 5*time.Minute); !got.due {
+		t.Errorf("want the repair not deferred, got %+v", got)
+	}
+}
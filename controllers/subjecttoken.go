@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apstndb/image-pull-secret-controller/internal/tokensource"
+	"golang.org/x/oauth2"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+// subjectTokenSource returns the token source of the subject token exchanged with STS.
+// audience is the default audience of the workload identity pool provider.
+func (r *ImagePullSecretReconciler) subjectTokenSource(ctx context.Context, res *examplev1alpha1.ImagePullSecret, audience string) (oauth2.TokenSource, error) {
+	spec := res.Spec.SubjectToken
+	switch {
+	case spec == nil:
+		return r.kubernetesTokenSource(ctx, res, audience)
+	case spec.File != nil:
+		if !r.Settings().AllowLocalSubjectTokenSources {
+			return nil, &tokensource.PermanentError{Err: fmt.Errorf("spec.subjectToken.file is not allowed by the controller")}
+		}
+		return tokensource.FileTokenSource(spec.File.Path)
+	case spec.OIDC != nil:
+		// The client secret is sent to the issuer chosen by the requester,
+		// so it is read only if the requester may get it by itself.
+		if r.Settings().SkipRequesterAuthorization {
+			return nil, &tokensource.PermanentError{Err: fmt.Errorf("spec.subjectToken.oidc is not allowed by the controller without the requester authorization")}
+		}
+		clientSecret, err := r.secretValue(ctx, res.Namespace, spec.OIDC.ClientSecretRef.Name, spec.OIDC.ClientSecretRef.Key)
+		if err != nil {
+			return nil, err
+		}
+		return tokensource.OidcClientCredentialsTokenSource(ctx, &tokensource.OidcClientCredentialsTokenConfig{
+			Issuer:       spec.OIDC.Issuer,
+			ClientID:     spec.OIDC.ClientID,
+			ClientSecret: clientSecret,
+			Scopes:       spec.OIDC.Scopes,
+			Audience:     spec.OIDC.Audience,
+			Transport:    r.transport,
+		})
+	case spec.Executable != nil:
+		if !r.Settings().AllowLocalSubjectTokenSources {
+			return nil, &tokensource.PermanentError{Err: fmt.Errorf("spec.subjectToken.executable is not allowed by the controller")}
+		}
+		var timeout time.Duration
+		if spec.Executable.TimeoutMillis != nil {
+			timeout = time.Duration(*spec.Executable.TimeoutMillis) * time.Millisecond
+		}
+		ts, err := tokensource.ExecutableTokenSource(ctx, &tokensource.ExecutableTokenConfig{
+			Command:          spec.Executable.Command,
+			Timeout:          timeout,
+			OutputFile:       spec.Executable.OutputFile,
+			Audience:         audience,
+			SubjectTokenType: "urn:ietf:params:oauth:token-type:jwt",
+		})
+		if err != nil {
+			return nil, &tokensource.PermanentError{Err: err}
+		}
+		return ts, nil
+	default:
+		return nil, &tokensource.PermanentError{Err: fmt.Errorf("spec.subjectToken must have one of file, oidc or executable")}
+	}
+}
+
+func (r *ImagePullSecretReconciler) kubernetesTokenSource(ctx context.Context, res *examplev1alpha1.ImagePullSecret, audience string) (oauth2.TokenSource, error) {
+	ktsConfig := &tokensource.KubernetsTokenRequestTokenConfig{
+		ServiceAccountNamespace: res.Namespace,
+		ServiceAccountName:      res.Spec.ServiceAccountName,
+		Audiences:               []string{audience},
+	}
+	if satSpec := res.Spec.ServiceAccountToken; satSpec != nil {
+		if satSpec.Audience != "" {
+			ktsConfig.Audiences = []string{satSpec.Audience}
+		}
+		ktsConfig.ExpirationSeconds = satSpec.ExpirationSeconds
+		if satSpec.BindToSecret {
+			ref, err := r.secretObjectReference(ctx, res)
+			if err != nil {
+				return nil, err
+			}
+			ktsConfig.BoundObjectRef = ref
+		}
+	}
+	return tokensource.KubernetesTokenRequestTokenSource(ctx, r.ClientSet, ktsConfig)
+}
+
+// secretObjectReference returns the reference to the generated Secret to bind the service account token.
+// It returns nil if the Secret doesn't exist yet.
+func (r *ImagePullSecretReconciler) secretObjectReference(ctx context.Context, res *examplev1alpha1.ImagePullSecret) (*authenticationv1.BoundObjectReference, error) {
+	// Use the clientset not to cache all Secrets in the cluster.
+	secret, err := r.ClientSet.CoreV1().Secrets(res.Namespace).Get(ctx, currentSecretName(res), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &authenticationv1.BoundObjectReference{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Name:       secret.Name,
+		UID:        secret.UID,
+	}, nil
+}
+
+// secretValue returns the value of the key in the Secret.
+func (r *ImagePullSecretReconciler) secretValue(ctx context.Context, namespace, name, key string) (string, error) {
+	secret, err := r.ClientSet.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	v, ok := secret.Data[key]
+	if !ok {
+		return "", &tokensource.PermanentError{Err: fmt.Errorf("key %q is not found in Secret %s/%s", key, namespace, name)}
+	}
+	return string(v), nil
+}
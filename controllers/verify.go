@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+// Reasons of the RegistryAccessVerified condition.
+const (
+	reasonRegistryAccessVerified = "Verified"
+	reasonRegistryAccessDenied   = "AccessDenied"
+	reasonVerificationFailed     = "VerificationFailed"
+)
+
+// verifyTimeout bounds the verification of all images of an ImagePullSecret.
+const verifyTimeout = 30 * time.Second
+
+// manifestMediaTypes are accepted on HEAD so that registries don't reject the request for multi-arch images.
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// registryAccessError is returned when the registry rejects the credential for the image.
+type registryAccessError struct {
+	image  string
+	status int
+}
+
+func (e *registryAccessError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.image, e.status, http.StatusText(e.status))
+}
+
+// imageReference is a parsed image reference, e.g. us-docker.pkg.dev/project/repo/image:tag.
+type imageReference struct {
+	host       string
+	repository string
+	// reference is a tag or a digest.
+	reference string
+}
+
+func parseImageReference(image string) (*imageReference, error) {
+	host := imageRegistryHost(image)
+	rest := strings.TrimPrefix(image, host+"/")
+	ref := "latest"
+	if i := strings.IndexRune(rest, '@'); i >= 0 {
+		rest, ref = rest[:i], rest[i+1:]
+	} else if i := strings.LastIndexByte(rest, ':'); i > strings.LastIndexByte(rest, '/') {
+		rest, ref = rest[:i], rest[i+1:]
+	}
+	if rest == "" || ref == "" {
+		return nil, fmt.Errorf("invalid image reference: %q", image)
+	}
+	if host == "docker.io" && !strings.Contains(rest, "/") {
+		rest = "library/" + rest
+	}
+	return &imageReference{host: host, repository: rest, reference: ref}, nil
+}
+
+// baseURL returns the URL of the registry API.
+func (ref *imageReference) baseURL() string {
+	if ref.host == "docker.io" {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + ref.host
+}
+
+// verifyImage performs the token handshake of Docker Registry HTTP API V2 with the credential
+// and HEAD on the manifest of the image, as the kubelet does on pull.
+func verifyImage(ctx context.Context, client *http.Client, image, username, password string) error {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return err
+	}
+	base := ref.baseURL()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/v2/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	var authorization string
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+		switch strings.ToLower(scheme) {
+		case "bearer":
+			token, err := registryToken(ctx, client, params, ref, username, password)
+			if err != nil {
+				return fmt.Errorf("%s: %w", image, err)
+			}
+			authorization = "Bearer " + token
+		case "basic":
+			req.SetBasicAuth(username, password)
+			authorization = req.Header.Get("Authorization")
+		default:
+			return fmt.Errorf("%s: unsupported authentication scheme: %q", image, scheme)
+		}
+	default:
+		return fmt.Errorf("%s: GET /v2/: unexpected status %d", image, resp.StatusCode)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodHead, fmt.Sprintf("%s/v2/%s/manifests/%s", base, ref.repository, ref.reference), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return &registryAccessError{image: image, status: resp.StatusCode}
+	default:
+		return fmt.Errorf("%s: HEAD manifest: unexpected status %d", image, resp.StatusCode)
+	}
+}
+
+// registryToken gets the bearer token to pull the repository from the token service in the challenge.
+func registryToken(ctx context.Context, client *http.Client, params map[string]string, ref *imageReference, username, password string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid realm of the challenge: %q", params["realm"])
+	}
+	q := realm.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	q.Set("scope", fmt.Sprintf("repository:%s:pull", ref.repository))
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(username, password)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", &registryAccessError{image: ref.host + "/" + ref.repository, status: resp.StatusCode}
+	default:
+		return "", fmt.Errorf("token service: unexpected status %d", resp.StatusCode)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token service: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("token service: no token in the response")
+}
+
+// parseChallenge parses WWW-Authenticate header, e.g. `Bearer realm="https://gcr.io/v2/token",service="gcr.io"`.
+func parseChallenge(header string) (string, map[string]string) {
+	header = strings.TrimSpace(header)
+	scheme, rest := header, ""
+	if i := strings.IndexByte(header, ' '); i >= 0 {
+		scheme, rest = header[:i], header[i+1:]
+	}
+	params := make(map[string]string)
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		i := strings.IndexByte(rest, '=')
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:i]))
+		rest = rest[i+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if j := strings.IndexByte(rest, ','); j >= 0 {
+			value, rest = rest[:j], rest[j+1:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+// verifyRegistryAccess verifies spec.verify.images with the minted access token and records the RegistryAccessVerified condition.
+// Failures don't fail the reconciliation because the Secret may still be valid for the other images.
+func (r *ImagePullSecretReconciler) verifyRegistryAccess(ctx context.Context, res *examplev1alpha1.ImagePullSecret, accessToken string) {
+	if res.Spec.Verify == nil {
+		meta.RemoveStatusCondition(&res.Status.Conditions, examplev1alpha1.ConditionRegistryAccessVerified)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	registries := make(map[string]bool)
+	for _, reg := range r.registries(res) {
+		registries[reg] = true
+	}
+	client := r.transport.HTTPClient()
+
+	reason := reasonRegistryAccessVerified
+	var failures []string
+	for _, image := range res.Spec.Verify.Images {
+		if host := imageRegistryHost(image); !registries[host] {
+			reason = reasonRegistryAccessDenied
+			failures = append(failures, fmt.Sprintf("%s: registry %s is not in the Secret", image, host))
+			continue
+		}
+		err := verifyImage(ctx, client, image, dockerConfigUsername, accessToken)
+		if err == nil {
+			continue
+		}
+		failures = append(failures, err.Error())
+		var accessErr *registryAccessError
+		if stderrors.As(err, &accessErr) {
+			reason = reasonRegistryAccessDenied
+		} else if reason == reasonRegistryAccessVerified {
+			reason = reasonVerificationFailed
+		}
+	}
+
+	cond := metav1.Condition{
+		Type:               examplev1alpha1.ConditionRegistryAccessVerified,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            "all images in spec.verify are readable",
+		ObservedGeneration: res.Generation,
+	}
+	if len(failures) > 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Message = strings.Join(failures, "; ")
+		if r.Recorder != nil {
+			r.Recorder.Event(res, corev1.EventTypeWarning, reason, cond.Message)
+		}
+	}
+	meta.SetStatusCondition(&res.Status.Conditions, cond)
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  imageReference
+	}{
+		{"us-docker.pkg.dev/project/repo/image:tag", imageReference{"us-docker.pkg.dev", "project/repo/image", "tag"}},
+		{"gcr.io/project/image", imageReference{"gcr.io", "project/image", "latest"}},
+		{"gcr.io/project/image@sha256:0123", imageReference{"gcr.io", "project/image", "sha256:0123"}},
+		{"registry.example.com:5000/image", imageReference{"registry.example.com:5000", "image", "latest"}},
+		{"nginx:1.21", imageReference{"docker.io", "library/nginx", "1.21"}},
+	}
+	for _, tt := range tests {
+		got, err := parseImageReference(tt.image)
+		if err != nil {
+			t.Errorf("parseImageReference(%q): %v", tt.image, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("parseImageReference(%q): want %+v, got %+v", tt.image, tt.want, *got)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://gcr.io/v2/token",service="gcr.io",scope="repository:a,b:pull"`)
+	if scheme != "Bearer" || params["realm"] != "https://gcr.io/v2/token" || params["service"] != "gcr.io" || params["scope"] != "repository:a,b:pull" {
+		t.Errorf("parseChallenge: got %q %v", scheme, params)
+	}
+}
+
+// newRegistry returns an in-process registry which allows the password to pull project/allowed.
+func newRegistry(t *testing.T, password string) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v2/" || req.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/v2/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		switch req.URL.Path {
+		case "/v2/project/allowed/manifests/latest", "/v2/project/allowed/manifests/sha256:0123":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/project/denied/manifests/latest":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("/v2/token", func(w http.ResponseWriter, req *http.Request) {
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != dockerConfigUsername || pass != password || req.URL.Query().Get("service") != "test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.HasPrefix(req.URL.Query().Get("scope"), "repository:project/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"registry-token"}`))
+	})
+	srv = httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVerifyImage(t *testing.T) {
+	srv := newRegistry(t, "access-token")
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	tests := []struct {
+		desc       string
+		image      string
+		password   string
+		wantStatus int // 0 means success
+	}{
+		{"allowed", host + "/project/allowed", "access-token", 0},
+		{"allowed by digest", host + "/project/allowed@sha256:0123", "access-token", 0},
+		{"forbidden repository", host + "/project/denied", "access-token", http.StatusForbidden},
+		{"missing image", host + "/project/allowed:missing", "access-token", http.StatusNotFound},
+		{"wrong token", host + "/project/allowed", "stale-token", http.StatusUnauthorized},
+		{"forbidden scope", host + "/other/allowed", "access-token", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		err := verifyImage(context.Background(), srv.Client(), tt.image, dockerConfigUsername, tt.password)
+		if tt.wantStatus == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.desc, err)
+			}
+			continue
+		}
+		var accessErr *registryAccessError
+		if !stderrors.As(err, &accessErr) || accessErr.status != tt.wantStatus {
+			t.Errorf("%s: want registryAccessError with %d, got %v", tt.desc, tt.wantStatus, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	examplev1alpha1 "github.com/apstndb/image-pull-secret-controller/api/v1alpha1"
+)
+
+var warmUpLog = ctrl.Log.WithName("warm-up")
+
+// warmUp tracks the first reconcile of each ImagePullSecret which existed when the controller started.
+// The first reconcile reuses the credential recorded in the status and schedules the next refresh,
+// so the warm-up completes without minting unless the credential is expiring or the Secret is modified.
+type warmUp struct {
+	mu      sync.Mutex
+	started bool
+	pending map[types.NamespacedName]bool
+	// early are reconciled before the warm-up is started, because the controller doesn't wait for it.
+	early map[types.NamespacedName]bool
+}
+
+// start records the ImagePullSecrets to be reconciled.
+func (w *warmUp) start(keys []types.NamespacedName) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = make(map[types.NamespacedName]bool, len(keys))
+	for _, key := range keys {
+		if !w.early[key] {
+			w.pending[key] = true
+		}
+	}
+	w.early = nil
+	w.started = true
+}
+
+// observe records that the ImagePullSecret is reconciled regardless of the result,
+// because a broken ImagePullSecret must not keep the replica unready forever.
+func (w *warmUp) observe(key types.NamespacedName) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.started {
+		if w.early == nil {
+			w.early = make(map[types.NamespacedName]bool)
+		}
+		w.early[key] = true
+		return
+	}
+	delete(w.pending, key)
+}
+
+// remaining returns the number of the ImagePullSecrets not reconciled yet for which owns is true.
+func (w *warmUp) remaining(owns func(namespace string) bool) (int, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for key := range w.pending {
+		if owns(key.Namespace) {
+			n++
+		}
+	}
+	return n, w.started
+}
+
+// startWarmUp lists the ImagePullSecrets after the cache is synced. It runs only in the replica which reconciles.
+func (r *ImagePullSecretReconciler) startWarmUp(mgr ctrl.Manager) error {
+	return mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		if !mgr.GetCache().WaitForCacheSync(ctx) {
+			return fmt.Errorf("unable to sync the cache for the warm-up")
+		}
+		var list examplev1alpha1.ImagePullSecretList
+		if err := r.List(ctx, &list); err != nil {
+			return err
+		}
+		var keys []types.NamespacedName
+		for i := range list.Items {
+			res := &list.Items[i]
+			if r.inScope(res.Namespace) && !parked(res) {
+				keys = append(keys, types.NamespacedName{Namespace: res.Namespace, Name: res.Name})
+			}
+		}
+		r.warmUp.start(keys)
+		warmUpLog.Info("reconcile the existing ImagePullSecrets", "count", len(keys))
+		return nil
+	}))
+}
+
+// WarmUpCheck is a readiness check which fails until the ImagePullSecrets existing at startup are reconciled once.
+// Replicas waiting for the leader election are ready because they only serve the webhook.
+func (r *ImagePullSecretReconciler) WarmUpCheck(_ *http.Request) error {
+	if !r.elected() {
+		return nil
+	}
+	n, started := r.warmUp.remaining(r.ownsShard)
+	if !started {
+		return fmt.Errorf("the warm-up is not started")
+	}
+	if n > 0 {
+		return fmt.Errorf("%d ImagePullSecrets are not reconciled yet", n)
+	}
+	return nil
+}
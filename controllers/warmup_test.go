@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestWarmUp(t *testing.T) {
+	a := types.NamespacedName{Namespace: "team-a", Name: "a"}
+	b := types.NamespacedName{Namespace: "team-b", Name: "b"}
+	c := types.NamespacedName{Namespace: "team-a", Name: "c"}
+	all := func(string) bool { return true }
+
+	var w warmUp
+	if _, started := w.remaining(all); started {
+		t.Fatal("want not started")
+	}
+	// Reconciled before the warm-up lists the ImagePullSecrets.
+	w.observe(a)
+	w.start([]types.NamespacedName{a, b, c})
+	if n, started := w.remaining(all); !started || n != 2 {
+		t.Errorf("want 2 remaining, got %d (started=%v)", n, started)
+	}
+	// ImagePullSecrets in the shards of the other replicas are not waited for.
+	if n, _ := w.remaining(func(ns string) bool { return ns == "team-a" }); n != 1 {
+		t.Errorf("want 1 remaining in team-a, got %d", n)
+	}
+	w.observe(b)
+	w.observe(c)
+	if n, _ := w.remaining(all); n != 0 {
+		t.Errorf("want none remaining, got %d", n)
+	}
+}
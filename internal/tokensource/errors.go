@@ -0,0 +1,142 @@
+package tokensource
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	errdetails "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ErrorClass describes how a caller should retry an error returned by a token source.
+type ErrorClass int
+
+const (
+	// ErrorClassTransient errors may succeed on retry and should be retried with backoff.
+	ErrorClassTransient ErrorClass = iota
+	// ErrorClassPermanent errors will not succeed without a configuration change.
+	ErrorClassPermanent
+	// ErrorClassQuota errors are caused by rate limits or quota exhaustion.
+	ErrorClassQuota
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassPermanent:
+		return "Permanent"
+	case ErrorClassQuota:
+		return "Quota"
+	default:
+		return "Transient"
+	}
+}
+
+// PermanentError marks Err as permanent regardless of its underlying type.
+// It is useful for validation errors which are found before calling any API.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// notFoundRetryDelay is the delay before retrying NotFound errors.
+// A missing Kubernetes service account or an IAM binding not propagated yet is resolved
+// without changing the ImagePullSecret, so they are retried but not as often as other transient errors.
+const notFoundRetryDelay = 5 * time.Minute
+
+// ClassifyError classifies errors from STS, IAM Credentials and Kubernetes TokenRequest.
+// The returned duration is the server suggested delay, or zero if the server didn't suggest one.
+// NotFound errors are transient with notFoundRetryDelay.
+// Unknown errors are treated as transient.
+func ClassifyError(err error) (ErrorClass, time.Duration) {
+	if err == nil {
+		return ErrorClassTransient, 0
+	}
+
+	var permanentErr *PermanentError
+	if errors.As(err, &permanentErr) {
+		return ErrorClassPermanent, 0
+	}
+
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		if gerr.Code == http.StatusNotFound {
+			return ErrorClassTransient, notFoundRetryDelay
+		}
+		return classifyHTTPStatus(gerr.Code), parseRetryAfter(gerr.Header)
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		return classifyGRPCStatus(grpcErr.GRPCStatus())
+	}
+
+	if apiStatus := apierrors.APIStatus(nil); errors.As(err, &apiStatus) {
+		if apierrors.IsNotFound(err) {
+			return ErrorClassTransient, notFoundRetryDelay
+		}
+		var retryAfter time.Duration
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return classifyHTTPStatus(int(apiStatus.Status().Code)), retryAfter
+	}
+
+	return ErrorClassTransient, 0
+}
+
+func classifyHTTPStatus(code int) ErrorClass {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return ErrorClassQuota
+	case code == http.StatusRequestTimeout, code == http.StatusConflict:
+		return ErrorClassTransient
+	case code >= 400 && code < 500:
+		return ErrorClassPermanent
+	default:
+		return ErrorClassTransient
+	}
+}
+
+func classifyGRPCStatus(s *status.Status) (ErrorClass, time.Duration) {
+	switch s.Code() {
+	case codes.ResourceExhausted:
+		for _, d := range s.Details() {
+			if ri, ok := d.(*errdetails.RetryInfo); ok && ri.GetRetryDelay() != nil {
+				return ErrorClassQuota, ri.GetRetryDelay().AsDuration()
+			}
+		}
+		return ErrorClassQuota, 0
+	case codes.NotFound:
+		return ErrorClassTransient, notFoundRetryDelay
+	case codes.InvalidArgument, codes.PermissionDenied, codes.Unauthenticated,
+		codes.FailedPrecondition, codes.OutOfRange, codes.Unimplemented, codes.AlreadyExists:
+		return ErrorClassPermanent, 0
+	default:
+		return ErrorClassTransient, 0
+	}
+}
+
+// parseRetryAfter parses Retry-After header in both delay-seconds and HTTP-date forms.
+func parseRetryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
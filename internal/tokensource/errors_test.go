@@ -0,0 +1,54 @@
+package tokensource
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	errdetails "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClassifyError(t *testing.T) {
+	quotaStatus, _ := status.New(codes.ResourceExhausted, "quota").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(7 * time.Second)})
+
+	tests := []struct {
+		desc           string
+		err            error
+		wantClass      ErrorClass
+		wantRetryAfter time.Duration
+	}{
+		{"unknown", errors.New("unknown"), ErrorClassTransient, 0},
+		{"marked permanent", fmt.Errorf("validate: %w", &PermanentError{errors.New("invalid")}), ErrorClassPermanent, 0},
+		{"sts unavailable", fmt.Errorf("sts.Token: %w", &googleapi.Error{Code: http.StatusServiceUnavailable}), ErrorClassTransient, 0},
+		{"sts bad audience", fmt.Errorf("sts.Token: %w", &googleapi.Error{Code: http.StatusBadRequest}), ErrorClassPermanent, 0},
+		{"sts not found", fmt.Errorf("sts.Token: %w", &googleapi.Error{Code: http.StatusNotFound}), ErrorClassTransient, notFoundRetryDelay},
+		{"sts too many requests", fmt.Errorf("sts.Token: %w", &googleapi.Error{Code: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"12"}}}), ErrorClassQuota, 12 * time.Second},
+		{"iam permission denied", fmt.Errorf("iamcredentials.GenerateAccessToken: %w", status.Error(codes.PermissionDenied, "denied")), ErrorClassPermanent, 0},
+		{"iam not found", fmt.Errorf("iamcredentials.GenerateAccessToken: %w", status.Error(codes.NotFound, "not found")), ErrorClassTransient, notFoundRetryDelay},
+		{"iam unavailable", fmt.Errorf("iamcredentials.GenerateAccessToken: %w", status.Error(codes.Unavailable, "unavailable")), ErrorClassTransient, 0},
+		{"iam resource exhausted", fmt.Errorf("iamcredentials.GenerateAccessToken: %w", quotaStatus.Err()), ErrorClassQuota, 7 * time.Second},
+		{"token request forbidden", fmt.Errorf("serviceaccounts.CreateToken: %w", apierrors.NewForbidden(schema.GroupResource{Resource: "serviceaccounts"}, "default", errors.New("forbidden"))), ErrorClassPermanent, 0},
+		{"token request service account not found", fmt.Errorf("serviceaccounts.CreateToken: %w", apierrors.NewNotFound(schema.GroupResource{Resource: "serviceaccounts"}, "default")), ErrorClassTransient, notFoundRetryDelay},
+		{"token request too many requests", fmt.Errorf("serviceaccounts.CreateToken: %w", apierrors.NewTooManyRequests("slow down", 3)), ErrorClassQuota, 3 * time.Second},
+		{"token request internal error", fmt.Errorf("serviceaccounts.CreateToken: %w", apierrors.NewInternalError(errors.New("internal"))), ErrorClassTransient, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			class, retryAfter := ClassifyError(tt.err)
+			if class != tt.wantClass {
+				t.Errorf("class: want %v, got %v", tt.wantClass, class)
+			}
+			if retryAfter != tt.wantRetryAfter {
+				t.Errorf("retryAfter: want %v, got %v", tt.wantRetryAfter, retryAfter)
+			}
+		})
+	}
+}
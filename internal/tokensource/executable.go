@@ -0,0 +1,156 @@
+package tokensource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// The environment variable and the protocol follow executable-sourced credentials of Google auth libraries.
+// https://google.aip.dev/auth/4117#determining-the-subject-token-in-executable-sourced-credentials
+const (
+	allowExecutablesEnv = "GOOGLE_EXTERNAL_ACCOUNT_ALLOW_EXECUTABLES"
+
+	defaultExecutableTimeout = 30 * time.Second
+	minExecutableTimeout     = 5 * time.Second
+	maxExecutableTimeout     = 120 * time.Second
+
+	executableResponseVersion = 1
+)
+
+type ExecutableTokenConfig struct {
+	// Command is split by whitespace, and executed without shell.
+	Command string
+	// Timeout defaults to 30 seconds. It must be between 5 and 120 seconds.
+	Timeout time.Duration
+	// OutputFile caches the response of the executable if not empty.
+	OutputFile string
+	// Audience and SubjectTokenType are passed to the executable.
+	Audience         string
+	SubjectTokenType string
+}
+
+type executableResponse struct {
+	Version        int    `json:"version"`
+	Success        bool   `json:"success"`
+	TokenType      string `json:"token_type"`
+	IDToken        string `json:"id_token"`
+	SamlResponse   string `json:"saml_response"`
+	ExpirationTime int64  `json:"expiration_time"`
+	Code           string `json:"code"`
+	Message        string `json:"message"`
+}
+
+type executableTokenSource struct {
+	ExecutableTokenConfig
+	ctx context.Context
+}
+
+func (ts *executableTokenSource) Token() (*oauth2.Token, error) {
+	if ts.OutputFile != "" {
+		if t, ok := ts.cachedToken(); ok {
+			return t, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ts.ctx, ts.Timeout)
+	defer cancel()
+
+	args := strings.Fields(ts.Command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"GOOGLE_EXTERNAL_ACCOUNT_AUDIENCE="+ts.Audience,
+		"GOOGLE_EXTERNAL_ACCOUNT_TOKEN_TYPE="+ts.SubjectTokenType,
+		"GOOGLE_EXTERNAL_ACCOUNT_INTERACTIVE=0",
+	)
+	if ts.OutputFile != "" {
+		cmd.Env = append(cmd.Env, "GOOGLE_EXTERNAL_ACCOUNT_OUTPUT_FILE="+ts.OutputFile)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("executable %q: %w", args[0], err)
+	}
+	return parseExecutableResponse(stdout.Bytes(), ts.OutputFile != "")
+}
+
+// cachedToken returns the token in OutputFile if it is still valid.
+func (ts *executableTokenSource) cachedToken() (*oauth2.Token, bool) {
+	b, err := ioutil.ReadFile(ts.OutputFile)
+	if err != nil || len(bytes.TrimSpace(b)) == 0 {
+		return nil, false
+	}
+	t, err := parseExecutableResponse(b, true)
+	if err != nil || !t.Valid() {
+		return nil, false
+	}
+	return t, true
+}
+
+func parseExecutableResponse(b []byte, requireExpiration bool) (*oauth2.Token, error) {
+	var resp executableResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, fmt.Errorf("executable response: %w", err)
+	}
+	if resp.Version != executableResponseVersion {
+		return nil, fmt.Errorf("executable response: unsupported version: %d", resp.Version)
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("executable response: %s: %s", resp.Code, resp.Message)
+	}
+	if requireExpiration && resp.ExpirationTime == 0 {
+		return nil, fmt.Errorf("executable response: expiration_time is required when output file is used")
+	}
+
+	var token string
+	switch resp.TokenType {
+	case "urn:ietf:params:oauth:token-type:jwt", "urn:ietf:params:oauth:token-type:id_token":
+		token = resp.IDToken
+	case "urn:ietf:params:oauth:token-type:saml2":
+		token = resp.SamlResponse
+	default:
+		return nil, fmt.Errorf("executable response: unsupported token type: %s", resp.TokenType)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("executable response: token is empty")
+	}
+
+	var expiry time.Time
+	if resp.ExpirationTime != 0 {
+		expiry = time.Unix(resp.ExpirationTime, 0)
+		if time.Now().After(expiry) {
+			return nil, fmt.Errorf("executable response: token is expired")
+		}
+	}
+	return &oauth2.Token{AccessToken: token, Expiry: expiry}, nil
+}
+
+// ExecutableTokenSource runs the command to retrieve the subject token.
+// It is allowed only if GOOGLE_EXTERNAL_ACCOUNT_ALLOW_EXECUTABLES=1, as Google auth libraries do.
+func ExecutableTokenSource(ctx context.Context, config *ExecutableTokenConfig) (oauth2.TokenSource, error) {
+	if os.Getenv(allowExecutablesEnv) != "1" {
+		return nil, fmt.Errorf("executables are not allowed, set %s=1 to allow them", allowExecutablesEnv)
+	}
+	c := *config
+	if len(strings.Fields(c.Command)) == 0 {
+		return nil, fmt.Errorf("command is empty")
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultExecutableTimeout
+	}
+	if c.Timeout < minExecutableTimeout || c.Timeout > maxExecutableTimeout {
+		return nil, fmt.Errorf("timeout must be between %v and %v: %v", minExecutableTimeout, maxExecutableTimeout, c.Timeout)
+	}
+	return &executableTokenSource{
+		ctx:                   ctx,
+		ExecutableTokenConfig: c,
+	}, nil
+}
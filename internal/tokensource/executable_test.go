@@ -0,0 +1,42 @@
+package tokensource
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseExecutableResponse(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		desc              string
+		resp              string
+		requireExpiration bool
+		wantToken         string
+		wantErr           bool
+	}{
+		{"jwt", fmt.Sprintf(`{"version":1,"success":true,"token_type":"urn:ietf:params:oauth:token-type:jwt","id_token":"jwt","expiration_time":%d}`, exp), true, "jwt", false},
+		{"saml", `{"version":1,"success":true,"token_type":"urn:ietf:params:oauth:token-type:saml2","saml_response":"saml"}`, false, "saml", false},
+		{"missing expiration with output file", `{"version":1,"success":true,"token_type":"urn:ietf:params:oauth:token-type:jwt","id_token":"jwt"}`, true, "", true},
+		{"expired", `{"version":1,"success":true,"token_type":"urn:ietf:params:oauth:token-type:jwt","id_token":"jwt","expiration_time":1}`, false, "", true},
+		{"failure", `{"version":1,"success":false,"code":"401","message":"denied"}`, false, "", true},
+		{"unsupported version", `{"version":2,"success":true}`, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			token, err := parseExecutableResponse([]byte(tt.resp), tt.requireExpiration)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error, got token %v", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.AccessToken != tt.wantToken {
+				t.Errorf("want %q, got %q", tt.wantToken, token.AccessToken)
+			}
+		})
+	}
+}
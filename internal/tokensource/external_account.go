@@ -0,0 +1,155 @@
+package tokensource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ExternalAccountConfig is the credential configuration of type external_account,
+// which is generated by `gcloud iam workload-identity-pools create-cred-config`.
+// https://google.aip.dev/auth/4117
+type ExternalAccountConfig struct {
+	Type                           string                          `json:"type"`
+	Audience                       string                          `json:"audience"`
+	SubjectTokenType               string                          `json:"subject_token_type"`
+	TokenURL                       string                          `json:"token_url"`
+	ServiceAccountImpersonationURL string                          `json:"service_account_impersonation_url"`
+	CredentialSource               ExternalAccountCredentialSource `json:"credential_source"`
+}
+
+type ExternalAccountCredentialSource struct {
+	File       string                             `json:"file,omitempty"`
+	URL        string                             `json:"url,omitempty"`
+	Headers    map[string]string                  `json:"headers,omitempty"`
+	Executable *ExternalAccountExecutableSource   `json:"executable,omitempty"`
+	Format     ExternalAccountCredentialSourceFmt `json:"format,omitempty"`
+}
+
+type ExternalAccountExecutableSource struct {
+	Command       string `json:"command"`
+	TimeoutMillis int    `json:"timeout_millis,omitempty"`
+	OutputFile    string `json:"output_file,omitempty"`
+}
+
+type ExternalAccountCredentialSourceFmt struct {
+	// Type is "text" or "json". Defaults to "text".
+	Type                  string `json:"type,omitempty"`
+	SubjectTokenFieldName string `json:"subject_token_field_name,omitempty"`
+}
+
+var impersonationURLPattern = regexp.MustCompile(`/v1/projects/-/serviceAccounts/([^/:]+):generateAccessToken$`)
+
+// ParseExternalAccountConfig parses and validates the credential configuration.
+func ParseExternalAccountConfig(b []byte) (*ExternalAccountConfig, error) {
+	var c ExternalAccountConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("credential configuration: %w", err)
+	}
+	if c.Type != "external_account" {
+		return nil, fmt.Errorf("credential configuration: unsupported type: %q", c.Type)
+	}
+	if c.Audience == "" || c.SubjectTokenType == "" {
+		return nil, fmt.Errorf("credential configuration: audience and subject_token_type are required")
+	}
+	return &c, nil
+}
+
+// ServiceAccountEmail returns the email of the service account in service_account_impersonation_url.
+func (c *ExternalAccountConfig) ServiceAccountEmail() (string, error) {
+	m := impersonationURLPattern.FindStringSubmatch(c.ServiceAccountImpersonationURL)
+	if m == nil {
+		return "", fmt.Errorf("credential configuration: invalid service_account_impersonation_url: %q", c.ServiceAccountImpersonationURL)
+	}
+	return m[1], nil
+}
+
+// StsEndpoint returns the endpoint of the STS client in token_url.
+// It returns empty string if token_url is the default, so that callers can apply their own default.
+func (c *ExternalAccountConfig) StsEndpoint() (string, error) {
+	if c.TokenURL == "" || c.TokenURL == defaultStsTokenURL {
+		return "", nil
+	}
+	return StsEndpointFromTokenURL(c.TokenURL)
+}
+
+// IamCredentialsEndpoint returns the gRPC endpoint of IAM Credentials in service_account_impersonation_url.
+// It returns empty string if the host is the default, so that callers can apply their own default.
+func (c *ExternalAccountConfig) IamCredentialsEndpoint() (string, error) {
+	u, err := url.Parse(c.ServiceAccountImpersonationURL)
+	if err != nil {
+		return "", fmt.Errorf("credential configuration: invalid service_account_impersonation_url: %w", err)
+	}
+	if u.Hostname() == defaultIamCredentialsHost {
+		return "", nil
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	return u.Host + ":443", nil
+}
+
+// CredentialSourceTokenSource returns the token source of credential_source.
+// Every kind of the credential source runs in the caller, so callers must decide whether they are allowed.
+// transport is used by the URL credential source and may be nil.
+func (c *ExternalAccountConfig) CredentialSourceTokenSource(ctx context.Context, transport *Transport) (oauth2.TokenSource, error) {
+	cs := c.CredentialSource
+	var ts oauth2.TokenSource
+	var err error
+	switch {
+	case cs.File != "":
+		ts, err = FileTokenSource(cs.File)
+	case cs.URL != "":
+		ts, err = URLTokenSource(ctx, cs.URL, cs.Headers, transport)
+	case cs.Executable != nil:
+		// Executables print the response of their own format.
+		return ExecutableTokenSource(ctx, &ExecutableTokenConfig{
+			Command:          cs.Executable.Command,
+			Timeout:          time.Duration(cs.Executable.TimeoutMillis) * time.Millisecond,
+			OutputFile:       cs.Executable.OutputFile,
+			Audience:         c.Audience,
+			SubjectTokenType: c.SubjectTokenType,
+		})
+	default:
+		return nil, fmt.Errorf("credential configuration: unsupported credential_source")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch cs.Format.Type {
+	case "", "text":
+		return ts, nil
+	case "json":
+		return &jsonFieldTokenSource{ts: ts, field: cs.Format.SubjectTokenFieldName}, nil
+	default:
+		return nil, fmt.Errorf("credential configuration: unsupported credential_source.format.type: %q", cs.Format.Type)
+	}
+}
+
+// jsonFieldTokenSource extracts the token from the field of the JSON which the underlying token source returns.
+type jsonFieldTokenSource struct {
+	ts    oauth2.TokenSource
+	field string
+}
+
+func (ts *jsonFieldTokenSource) Token() (*oauth2.Token, error) {
+	t, err := ts.ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(t.AccessToken), &m); err != nil {
+		return nil, fmt.Errorf("subject token: %w", err)
+	}
+	token, ok := m[ts.field].(string)
+	if !ok || token == "" {
+		return nil, fmt.Errorf("subject token: field %q is not found", ts.field)
+	}
+	return &oauth2.Token{AccessToken: token, Expiry: jwtExpiry(token)}, nil
+}
@@ -0,0 +1,71 @@
+package tokensource
+
+import "testing"
+
+const testCredentialConfig = `{
+  "type": "external_account",
+  "audience": "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/provider",
+  "subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+  "token_url": "https://sts.example.p.googleapis.com/v1/token",
+  "service_account_impersonation_url": "https://iamcredentials.example.p.googleapis.com/v1/projects/-/serviceAccounts/puller@project.iam.gserviceaccount.com:generateAccessToken",
+  "credential_source": {
+    "file": "/var/run/secrets/tokens/token",
+    "format": {"type": "json", "subject_token_field_name": "id_token"}
+  }
+}`
+
+func TestParseExternalAccountConfig(t *testing.T) {
+	c, err := ParseExternalAccountConfig([]byte(testCredentialConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email, err := c.ServiceAccountEmail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "puller@project.iam.gserviceaccount.com"; email != want {
+		t.Errorf("ServiceAccountEmail: want %q, got %q", want, email)
+	}
+
+	endpoint, err := c.IamCredentialsEndpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "iamcredentials.example.p.googleapis.com:443"; endpoint != want {
+		t.Errorf("IamCredentialsEndpoint: want %q, got %q", want, endpoint)
+	}
+
+	stsEndpoint, err := c.StsEndpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://sts.example.p.googleapis.com/"; stsEndpoint != want {
+		t.Errorf("StsEndpoint: want %q, got %q", want, stsEndpoint)
+	}
+}
+
+func TestExternalAccountConfigDefaultEndpoints(t *testing.T) {
+	c := &ExternalAccountConfig{
+		TokenURL:                       "https://sts.googleapis.com/v1/token",
+		ServiceAccountImpersonationURL: "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/puller@project.iam.gserviceaccount.com:generateAccessToken",
+	}
+	if endpoint, err := c.StsEndpoint(); err != nil || endpoint != "" {
+		t.Errorf("StsEndpoint: want empty, got %q, %v", endpoint, err)
+	}
+	if endpoint, err := c.IamCredentialsEndpoint(); err != nil || endpoint != "" {
+		t.Errorf("IamCredentialsEndpoint: want empty, got %q, %v", endpoint, err)
+	}
+}
+
+func TestParseExternalAccountConfigInvalid(t *testing.T) {
+	for _, b := range []string{
+		`{}`,
+		`{"type": "service_account"}`,
+		`{"type": "external_account", "audience": "//iam.googleapis.com/projects/123"}`,
+	} {
+		if _, err := ParseExternalAccountConfig([]byte(b)); err == nil {
+			t.Errorf("want error for %s", b)
+		}
+	}
+}
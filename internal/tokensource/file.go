@@ -0,0 +1,30 @@
+package tokensource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+type fileTokenSource struct {
+	path string
+}
+
+func (ts *fileTokenSource) Token() (*oauth2.Token, error) {
+	b, err := ioutil.ReadFile(ts.path)
+	if err != nil {
+		return nil, fmt.Errorf("read subject token file: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return nil, fmt.Errorf("subject token file is empty: %s", ts.path)
+	}
+	return &oauth2.Token{AccessToken: token, Expiry: jwtExpiry(token)}, nil
+}
+
+// FileTokenSource reads the token from the file on each call, so it follows rotation of projected volumes.
+func FileTokenSource(path string) (oauth2.TokenSource, error) {
+	return &fileTokenSource{path: path}, nil
+}
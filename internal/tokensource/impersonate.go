@@ -0,0 +1,94 @@
+package tokensource
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/iam/credentials/apiv1"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	credentialspb "google.golang.org/genproto/googleapis/iam/credentials/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	cloudPlatformScope        = "https://www.googleapis.com/auth/cloud-platform"
+	defaultIamCredentialsHost = "iamcredentials.googleapis.com"
+)
+
+type ImpersonateTokenConfig struct {
+	// Target is the email of the service account to impersonate.
+	Target string
+	// Scopes defaults to cloud-platform scope if empty.
+	Scopes []string
+	// Lifetime defaults to one hour if zero.
+	// It can be up to 12 hours only if constraints/iam.allowServiceAccountCredentialLifetimeExtension allows.
+	Lifetime time.Duration
+	// Delegates are emails of the service accounts in the delegation chain.
+	// Each service account must be granted roles/iam.serviceAccountTokenCreator on the next one,
+	// and the last one on Target.
+	Delegates []string
+	// Endpoint overrides the gRPC endpoint of IAM Credentials, e.g. iamcredentials.googleapis.com:443.
+	Endpoint string
+	// Transport configures the proxy and TLS. Nil means the default.
+	Transport *Transport
+}
+
+type impersonateTokenSource struct {
+	ImpersonateTokenConfig
+	ctx               context.Context
+	sourceTokenSource oauth2.TokenSource
+}
+
+func ImpersonateTokenSource(ctx context.Context, ts oauth2.TokenSource, config *ImpersonateTokenConfig) (oauth2.TokenSource, error) {
+	c := *config
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{cloudPlatformScope}
+	}
+	return &impersonateTokenSource{
+		ctx:                    ctx,
+		sourceTokenSource:      ts,
+		ImpersonateTokenConfig: c,
+	}, nil
+}
+
+func (ts *impersonateTokenSource) Token() (*oauth2.Token, error) {
+	// Retrieve the source token before dialing so that its error is returned as is
+	// instead of being masked by gRPC as Unauthenticated.
+	sourceToken, err := ts.sourceTokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []option.ClientOption{option.WithTokenSource(oauth2.StaticTokenSource(sourceToken))}
+	if ts.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(ts.Endpoint))
+	}
+	transportOpts, err := ts.Transport.GRPCClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, transportOpts...)
+	client, err := credentials.NewIamCredentialsClient(ts.ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("iamcredentials.NewIamCredentialsClient: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	req := &credentialspb.GenerateAccessTokenRequest{
+		Name:  ts.Target,
+		Scope: ts.Scopes,
+	}
+	if ts.Lifetime != 0 {
+		req.Lifetime = durationpb.New(ts.Lifetime)
+	}
+	for _, d := range ts.Delegates {
+		req.Delegates = append(req.Delegates, fmt.Sprintf("projects/-/serviceAccounts/%s", d))
+	}
+	resp, err := client.GenerateAccessToken(ts.ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("iamcredentials.GenerateAccessToken: %w", err)
+	}
+	return &oauth2.Token{AccessToken: resp.GetAccessToken(), Expiry: resp.GetExpireTime().AsTime()}, nil
+}
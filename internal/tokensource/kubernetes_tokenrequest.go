@@ -2,6 +2,7 @@ package tokensource
 
 import (
 	"context"
+	"fmt"
 
 	"golang.org/x/oauth2"
 	authenticationv1 "k8s.io/api/authentication/v1"
@@ -13,6 +14,10 @@ type KubernetsTokenRequestTokenConfig struct {
 	ServiceAccountNamespace string
 	ServiceAccountName      string
 	Audiences               []string
+	// ExpirationSeconds defaults to the API server default if nil.
+	ExpirationSeconds *int64
+	// BoundObjectRef binds the token to the object so that it is invalidated when the object is deleted.
+	BoundObjectRef *authenticationv1.BoundObjectReference
 }
 
 type tokenRequestTokenSource struct {
@@ -29,12 +34,14 @@ func (t tokenRequestTokenSource) Token() (*oauth2.Token, error) {
 			t.ctx, t.ServiceAccountName,
 			&authenticationv1.TokenRequest{
 				Spec: authenticationv1.TokenRequestSpec{
-					Audiences: t.Audiences,
+					Audiences:         t.Audiences,
+					ExpirationSeconds: t.ExpirationSeconds,
+					BoundObjectRef:    t.BoundObjectRef,
 				},
 			},
 			metav1.CreateOptions{})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("serviceaccounts.CreateToken: %w", err)
 	}
 	return &oauth2.Token{
 		AccessToken: tokenRequestResp.Status.Token,
@@ -0,0 +1,105 @@
+package tokensource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+type OidcClientCredentialsTokenConfig struct {
+	// Issuer is the OpenID Provider which serves /.well-known/openid-configuration.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Audience is sent as audience parameter if not empty. Some providers require it to issue JWT.
+	Audience string
+	// Transport configures the proxy and TLS. Nil means the default.
+	Transport *Transport
+}
+
+type oidcClientCredentialsTokenSource struct {
+	OidcClientCredentialsTokenConfig
+	ctx context.Context
+
+	mu            sync.Mutex
+	tokenEndpoint string
+}
+
+func (ts *oidcClientCredentialsTokenSource) Token() (*oauth2.Token, error) {
+	tokenEndpoint, err := ts.discoverTokenEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &clientcredentials.Config{
+		ClientID:     ts.ClientID,
+		ClientSecret: ts.ClientSecret,
+		TokenURL:     tokenEndpoint,
+		Scopes:       ts.Scopes,
+	}
+	if ts.Audience != "" {
+		config.EndpointParams = map[string][]string{"audience": {ts.Audience}}
+	}
+	t, err := config.Token(ts.Transport.WithHTTPClient(ts.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("clientcredentials.Token: %w", err)
+	}
+
+	// Prefer ID token because STS requires JWT, and the access token may be opaque.
+	if idToken, ok := t.Extra("id_token").(string); ok && idToken != "" {
+		return &oauth2.Token{AccessToken: idToken, Expiry: jwtExpiry(idToken)}, nil
+	}
+	return &oauth2.Token{AccessToken: t.AccessToken, Expiry: t.Expiry}, nil
+}
+
+func (ts *oidcClientCredentialsTokenSource) discoverTokenEndpoint() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.tokenEndpoint != "" {
+		return ts.tokenEndpoint, nil
+	}
+
+	url := strings.TrimSuffix(ts.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ts.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := ts.Transport.HTTPClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("openid-configuration: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("openid-configuration: unexpected status: %s", resp.Status)
+	}
+
+	var discovery struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return "", fmt.Errorf("openid-configuration: %w", err)
+	}
+	if discovery.TokenEndpoint == "" {
+		return "", fmt.Errorf("openid-configuration: token_endpoint is missing in %s", url)
+	}
+	ts.tokenEndpoint = discovery.TokenEndpoint
+	return ts.tokenEndpoint, nil
+}
+
+// OidcClientCredentialsTokenSource issues a token from an external OpenID Provider by client credentials grant.
+func OidcClientCredentialsTokenSource(ctx context.Context, config *OidcClientCredentialsTokenConfig) (oauth2.TokenSource, error) {
+	if config.Issuer == "" || config.ClientID == "" {
+		return nil, fmt.Errorf("issuer and client ID are required")
+	}
+	return &oidcClientCredentialsTokenSource{
+		ctx:                              ctx,
+		OidcClientCredentialsTokenConfig: *config,
+	}, nil
+}
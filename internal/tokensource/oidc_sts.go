@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -12,14 +13,34 @@ import (
 	"google.golang.org/api/sts/v1"
 )
 
+const (
+	defaultSubjectTokenType = "urn:ietf:params:oauth:token-type:jwt"
+	defaultStsTokenURL      = "https://sts.googleapis.com/v1/token"
+)
+
+type OidcStsTokenConfig struct {
+	// Audience is the full resource name of the workload identity pool provider.
+	Audience string
+	// SubjectTokenType defaults to urn:ietf:params:oauth:token-type:jwt.
+	SubjectTokenType string
+	// Endpoint overrides the base URL of STS, e.g. https://sts.googleapis.com/.
+	Endpoint string
+	// Transport configures the proxy and TLS. Nil means the default.
+	Transport *Transport
+}
+
 type oidcStsTokenSource struct {
-	audience          string
+	OidcStsTokenConfig
 	SourceTokenSource oauth2.TokenSource
 	ctx               context.Context
 }
 
 func (ts *oidcStsTokenSource) Token() (*oauth2.Token, error) {
-	stsSvc, err := sts.NewService(ts.ctx, option.WithoutAuthentication())
+	opts := ts.Transport.HTTPClientOptions(nil)
+	if ts.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(ts.Endpoint))
+	}
+	stsSvc, err := sts.NewService(ts.ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -29,12 +50,12 @@ func (ts *oidcStsTokenSource) Token() (*oauth2.Token, error) {
 	}
 
 	req := &sts.GoogleIdentityStsV1ExchangeTokenRequest{
-		Audience:           ts.audience,
+		Audience:           ts.Audience,
 		GrantType:          "urn:ietf:params:oauth:grant-type:token-exchange",
 		RequestedTokenType: "urn:ietf:params:oauth:token-type:access_token",
 		Scope:              "https://www.googleapis.com/auth/iam",
 		SubjectToken:       t.AccessToken,
-		SubjectTokenType:   "urn:ietf:params:oauth:token-type:jwt",
+		SubjectTokenType:   ts.SubjectTokenType,
 	}
 	if debug {
 		_ = json.NewEncoder(os.Stderr).Encode(req)
@@ -62,10 +83,23 @@ func (ts *oidcStsTokenSource) Token() (*oauth2.Token, error) {
 }
 
 // OidcStsTokenSource exchanges OIDC token with federated token for internal use.
-func OidcStsTokenSource(ctx context.Context, audience string, ts oauth2.TokenSource) (oauth2.TokenSource, error) {
+func OidcStsTokenSource(ctx context.Context, ts oauth2.TokenSource, config *OidcStsTokenConfig) (oauth2.TokenSource, error) {
+	c := *config
+	if c.SubjectTokenType == "" {
+		c.SubjectTokenType = defaultSubjectTokenType
+	}
 	return &oidcStsTokenSource{
-		ctx:               ctx,
-		audience:          audience,
-		SourceTokenSource: ts,
+		ctx:                ctx,
+		OidcStsTokenConfig: c,
+		SourceTokenSource:  ts,
 	}, nil
 }
+
+// StsEndpointFromTokenURL converts token_url of the credential configuration to the endpoint of the STS client.
+// e.g. https://sts.googleapis.com/v1/token -> https://sts.googleapis.com/
+func StsEndpointFromTokenURL(tokenURL string) (string, error) {
+	if !strings.HasSuffix(tokenURL, "/v1/token") {
+		return "", fmt.Errorf("token_url must end with /v1/token: %s", tokenURL)
+	}
+	return strings.TrimSuffix(tokenURL, "v1/token"), nil
+}
@@ -0,0 +1,263 @@
+package tokensource
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
+)
+
+type TransportConfig struct {
+	// ProxyURL overrides the proxy in the environment variables. It may have the credential of the proxy as userinfo.
+	ProxyURL *url.URL
+	// CABundleFile is a PEM file of root CAs trusted in addition to the system roots, e.g. mounted from a ConfigMap.
+	CABundleFile string
+	// ClientCertFile and ClientKeyFile are a PEM key pair of the client certificate for mTLS.
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// Transport shares the proxy and TLS configuration between all outbound clients.
+// The files are reloaded when they are modified, so rotation of mounted ConfigMaps and Secrets takes effect without restart.
+// A nil *Transport is valid and means the default configuration.
+type Transport struct {
+	config TransportConfig
+
+	mu        sync.Mutex
+	modTimes  map[string]time.Time
+	tlsConfig *tls.Config
+	transport *http.Transport
+}
+
+// NewTransport loads the files once to report errors early.
+func NewTransport(config *TransportConfig) (*Transport, error) {
+	t := &Transport{config: *config}
+	if _, _, err := t.current(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t == nil {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	transport, _, err := t.current()
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+// HTTPClient returns a client without authentication.
+func (t *Transport) HTTPClient() *http.Client {
+	if t == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: t}
+}
+
+// HTTPClientOptions returns options of Google API clients over HTTP.
+// If ts is nil, the client doesn't authenticate.
+func (t *Transport) HTTPClientOptions(ts oauth2.TokenSource) []option.ClientOption {
+	if t == nil {
+		if ts == nil {
+			return []option.ClientOption{option.WithoutAuthentication()}
+		}
+		return []option.ClientOption{option.WithTokenSource(ts)}
+	}
+	if ts == nil {
+		return []option.ClientOption{option.WithHTTPClient(t.HTTPClient())}
+	}
+	return []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: &oauth2.Transport{Source: ts, Base: t}})}
+}
+
+// GRPCClientOptions returns options of Google API clients over gRPC.
+// They must be appended after the other options to take precedence over the default transport credentials.
+func (t *Transport) GRPCClientOptions() ([]option.ClientOption, error) {
+	if t == nil {
+		return nil, nil
+	}
+	_, tlsConfig, err := t.current()
+	if err != nil {
+		return nil, err
+	}
+	opts := []option.ClientOption{
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(grpccredentials.NewTLS(tlsConfig))),
+	}
+	if t.config.ProxyURL != nil {
+		opts = append(opts, option.WithGRPCDialOption(grpc.WithContextDialer(t.dialViaProxy)))
+	}
+	return opts, nil
+}
+
+// WithHTTPClient returns the context which makes golang.org/x/oauth2 use the transport.
+func (t *Transport) WithHTTPClient(ctx context.Context) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, t.HTTPClient())
+}
+
+// current returns the transport and the TLS configuration, reloading them if the files are modified.
+func (t *Transport) current() (*http.Transport, *tls.Config, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	modTimes := make(map[string]time.Time)
+	for _, f := range []string{t.config.CABundleFile, t.config.ClientCertFile, t.config.ClientKeyFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("transport: %w", err)
+		}
+		modTimes[f] = fi.ModTime()
+	}
+	if t.transport != nil && sameModTimes(t.modTimes, modTimes) {
+		return t.transport, t.tlsConfig, nil
+	}
+
+	tlsConfig, err := t.loadTLSConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if t.config.ProxyURL != nil {
+		transport.Proxy = http.ProxyURL(t.config.ProxyURL)
+	}
+
+	if t.transport != nil {
+		t.transport.CloseIdleConnections()
+	}
+	t.transport, t.tlsConfig, t.modTimes = transport, tlsConfig, modTimes
+	return t.transport, t.tlsConfig, nil
+}
+
+func (t *Transport) loadTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t.config.CABundleFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		b, err := ioutil.ReadFile(t.config.CABundleFile)
+		if err != nil {
+			return nil, fmt.Errorf("transport: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("transport: no certificate is found in %s", t.config.CABundleFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.config.ClientCertFile != "" || t.config.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.config.ClientCertFile, t.config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("transport: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func sameModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if !b[k].Equal(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialViaProxy opens a tunnel to addr by HTTP CONNECT method, because gRPC only respects the proxy in the environment variables.
+func (t *Transport) dialViaProxy(ctx context.Context, addr string) (net.Conn, error) {
+	proxy := t.config.ProxyURL
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		if proxy.Scheme == "https" {
+			proxyAddr = net.JoinHostPort(proxy.Hostname(), "443")
+		} else {
+			proxyAddr = net.JoinHostPort(proxy.Hostname(), "80")
+		}
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	if proxy.Scheme == "https" {
+		_, tlsConfig, err := t.current()
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = proxy.Hostname()
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxy.User; u != nil {
+		password, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy: CONNECT %s: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads the bytes buffered while reading the response of CONNECT first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,69 @@
+package tokensource
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransportReloadsCABundle(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile := func(b []byte, modTime time.Time) {
+		if err := ioutil.WriteFile(caFile, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		// Set mtime explicitly because the resolution of the file system may be coarse.
+		if err := os.Chtimes(caFile, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	writeFile(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), now)
+	transport, err := NewTransport(&TransportConfig{CABundleFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := transport.HTTPClient()
+
+	get := func() error {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if err := get(); err != nil {
+		t.Errorf("trusted server: %v", err)
+	}
+
+	writeFile([]byte("invalid"), now.Add(time.Minute))
+	if err := get(); err == nil {
+		t.Errorf("reloaded invalid bundle: want error, got nil")
+	}
+}
+
+func TestNilTransport(t *testing.T) {
+	var transport *Transport
+	if transport.HTTPClient() != http.DefaultClient {
+		t.Errorf("want http.DefaultClient")
+	}
+	opts, err := transport.GRPCClientOptions()
+	if err != nil || opts != nil {
+		t.Errorf("want no options, got %v, %v", opts, err)
+	}
+}
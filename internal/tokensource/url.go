@@ -0,0 +1,48 @@
+package tokensource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+type urlTokenSource struct {
+	ctx       context.Context
+	url       string
+	headers   map[string]string
+	transport *Transport
+}
+
+func (ts *urlTokenSource) Token() (*oauth2.Token, error) {
+	req, err := http.NewRequestWithContext(ts.ctx, http.MethodGet, ts.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range ts.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := ts.transport.HTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("subject token url: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("subject token url: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("subject token url: unexpected status: %s", resp.Status)
+	}
+	token := strings.TrimSpace(string(b))
+	return &oauth2.Token{AccessToken: token, Expiry: jwtExpiry(token)}, nil
+}
+
+// URLTokenSource retrieves the token from the URL on each call, e.g. a metadata server.
+// transport may be nil.
+func URLTokenSource(ctx context.Context, url string, headers map[string]string, transport *Transport) (oauth2.TokenSource, error) {
+	return &urlTokenSource{ctx: ctx, url: url, headers: headers, transport: transport}, nil
+}